@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/mishozz/library-cli/client"
@@ -8,38 +9,66 @@ import (
 )
 
 // NewGetBooksCmd returns cobra command for getting all book
-func NewGetBooksCmd(client client.BookClient) *cobra.Command {
+func NewGetBooksCmd(bookClient client.BookClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "get-all",
 		Short: "Get books from the library",
-		Long:  `Get specific book or all books from the library`,
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
+		Long: `Get all books from the library
 
-			respString, err := client.GetAllBooks(token)
+The books can be filtered, sorted and paged. The library REST API does this
+when it advertises support for it, otherwise the cli does.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to fetch books from library")
+				return err
 			}
-			fmt.Fprintf(cmd.OutOrStdout(), respString)
+			query, err := bookQuery(cmd)
+			if err != nil {
+				return err
+			}
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			books, err := bookClient.SearchBooks(ctx, token, query)
+			if err != nil {
+				return failure(err, "Unable to fetch books from library", "")
+			}
+			return p.print(cmd.OutOrStdout(), bookColumns, bookItems(books), false)
 		},
 	}
 }
 
 // NewGetBookCmd returns cobra command for getting a book
-func NewGetBookCmd(client client.BookClient) *cobra.Command {
+func NewGetBookCmd(bookClient client.BookClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "get",
 		Short: "Get specific book from the library",
 		Long:  "Get specific book from the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
-			isbn, _ := cmd.Flags().GetString("isbn")
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			isbn, err := isbnFlag(cmd)
+			if err != nil {
+				return err
+			}
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
 
-			respString, err := client.GetBook(token, isbn)
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			book, err := bookClient.FindBook(ctx, token, isbn)
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to fetch book with isbn %s from library", isbn)
+				return failure(err, fmt.Sprintf("Unable to fetch book with isbn %s from library", isbn), "")
 			}
-			fmt.Fprintf(cmd.OutOrStdout(), respString)
+			return p.print(cmd.OutOrStdout(), bookColumns, bookItems([]client.BookDetails{*book}), true)
 		},
 	}
 }
@@ -47,22 +76,31 @@ func NewGetBookCmd(client client.BookClient) *cobra.Command {
 // NewSaveBookCmd returns cobra command for saving a book
 func NewSaveBookCmd(client client.BookClient) *cobra.Command {
 	return &cobra.Command{
-		Use:   "save",
-		Short: "Save book",
-		Long:  "Save book in the library with the provided properties (isbn,title,author,units)",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
+		Use:         "save",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Save book",
+		Long:        "Save book in the library with the provided properties (isbn,title,author,units)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
 			title, _ := cmd.Flags().GetString("title")
 			author, _ := cmd.Flags().GetString("author")
 			units, _ := cmd.Flags().GetInt("units")
-			isbn, _ := cmd.Flags().GetString("isbn")
+			isbn, err := isbnFlag(cmd)
+			if err != nil {
+				return err
+			}
 
-			respString, err := client.SaveBook(token, isbn, title, author, uint(units))
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			respString, err := client.SaveBook(ctx, token, isbn, title, author, uint(units))
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to save book with isbn %s", isbn)
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				return failure(err, fmt.Sprintf("Unable to save book with isbn %s", isbn), "")
 			}
+			fmt.Fprint(cmd.OutOrStdout(), respString)
+			return nil
 		},
 	}
 }
@@ -70,60 +108,154 @@ func NewSaveBookCmd(client client.BookClient) *cobra.Command {
 // NewDeleteBookCmd returns cobra command for deleting a book
 func NewDeleteBookCmd(bookClient client.BookClient) *cobra.Command {
 	return &cobra.Command{
-		Use:   "delete",
-		Short: "Delete specific book from the library",
-		Long:  "Delete specific book from the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
-			isbn, _ := cmd.Flags().GetString("isbn")
-
-			err := bookClient.Delete(token, isbn)
-			if err != nil {
-				if err == client.UnauthorizedErr {
-					fmt.Fprintf(cmd.OutOrStdout(), "You need to be authorized to access this route")
-				} else {
-					fmt.Fprintf(cmd.OutOrStdout(), "Unable to delete book with isbn %s", isbn)
-				}
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), "Book with isbn %s successfully deleted", isbn)
+		Use:         "delete",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Delete specific book from the library",
+		Long:        "Delete specific book from the library",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
 			}
+			isbn, err := isbnFlag(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			err = bookClient.Delete(ctx, token, isbn)
+			if err != nil {
+				return failure(err, fmt.Sprintf("Unable to delete book with isbn %s", isbn), "")
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Book with isbn %s successfully deleted", isbn)
+			return nil
 		},
 	}
 }
 
+// NewUpdateBookCmd returns cobra command for updating a book
+func NewUpdateBookCmd(bookClient client.BookClient) *cobra.Command {
+	return &cobra.Command{
+		Use:         "update",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Update book",
+		Long: `Update the title, author or units of a book in the library, the other fields stay as they are.
+
+The book is written back with If-Match when the library REST API sends an ETag, so the update
+fails when someone else changed the book after it was read. Without ETags the update is not
+protected: a change someone else makes between the read and the write is overwritten.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			isbn, err := isbnFlag(cmd)
+			if err != nil {
+				return err
+			}
+			update, err := bookUpdate(cmd)
+			if err != nil {
+				return err
+			}
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			book, err := bookClient.UpdateBook(ctx, token, isbn, update)
+			action := fmt.Sprintf("Unable to update book with isbn %s", isbn)
+			if errors.Is(err, client.ErrBookChanged) || errors.Is(err, client.ErrNotEnoughUnits) {
+				return fmt.Errorf("%s: %w", action, err)
+			}
+			if err != nil {
+				return failure(err, action, "")
+			}
+			return p.print(cmd.OutOrStdout(), bookColumns, bookItems([]client.BookDetails{*book}), true)
+		},
+	}
+}
+
+// addBookUpdateFlags adds the flags which choose the changes of update
+func addBookUpdateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("title", "n", "", "New title of the book")
+	cmd.Flags().StringP("author", "a", "", "New author of the book")
+	cmd.Flags().UintP("units", "u", 0, "Set the available units")
+	cmd.Flags().Uint("add-units", 0, "Add to the available units")
+	cmd.Flags().Uint("remove-units", 0, "Remove from the available units")
+}
+
+// bookUpdate returns the changes chosen by the flags of update
+func bookUpdate(cmd *cobra.Command) (client.BookUpdate, error) {
+	var update client.BookUpdate
+	flags := cmd.Flags()
+	if flags.Changed("title") {
+		title, _ := flags.GetString("title")
+		update.Title = &title
+	}
+	if flags.Changed("author") {
+		author, _ := flags.GetString("author")
+		update.Author = &author
+	}
+
+	unitFlags := 0
+	for _, name := range []string{"units", "add-units", "remove-units"} {
+		if flags.Changed(name) {
+			unitFlags++
+		}
+	}
+	if unitFlags > 1 {
+		return update, usageError(errors.New("only one of --units, --add-units and --remove-units can be set"))
+	}
+	if flags.Changed("units") {
+		units, _ := flags.GetUint("units")
+		update.AvailableUnits = &units
+	}
+	add, _ := flags.GetUint("add-units")
+	remove, _ := flags.GetUint("remove-units")
+	update.AddUnits = int(add) - int(remove)
+
+	if update.Title == nil && update.Author == nil && unitFlags == 0 {
+		return update, usageError(errors.New("nothing to update, set --title, --author, --units, --add-units or --remove-units"))
+	}
+	return update, nil
+}
+
 func init() {
 	getBooksCmd := NewGetBooksCmd(client.Books)
 	getBookCmd := NewGetBookCmd(client.Books)
 	saveBookCmd := NewSaveBookCmd(client.Books)
 	deleteBookCmd := NewDeleteBookCmd(client.Books)
+	updateBookCmd := NewUpdateBookCmd(client.Books)
 
 	rootCmd.AddCommand(getBooksCmd)
 	rootCmd.AddCommand(getBookCmd)
 	rootCmd.AddCommand(saveBookCmd)
 	rootCmd.AddCommand(deleteBookCmd)
+	rootCmd.AddCommand(updateBookCmd)
 
-	getBooksCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	getBooksCmd.MarkFlagRequired("token")
+	addTokenFlags(getBooksCmd)
+	addBookQueryFlags(getBooksCmd)
 
-	getBookCmd.Flags().StringP("isbn", "i", "", "Isbn of the book")
-	getBookCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	getBookCmd.MarkFlagRequired("isbn")
-	getBookCmd.MarkFlagRequired("token")
+	addISBNFlags(getBookCmd)
+	addTokenFlags(getBookCmd)
 
-	deleteBookCmd.Flags().StringP("isbn", "i", "", "Isbn of the book")
-	deleteBookCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	deleteBookCmd.MarkFlagRequired("isbn")
-	deleteBookCmd.MarkFlagRequired("token")
+	addISBNFlags(deleteBookCmd)
+	addTokenFlags(deleteBookCmd)
 
-	saveBookCmd.Flags().StringP("isbn", "i", "", "Isbn of the book")
+	addISBNFlags(saveBookCmd)
 	saveBookCmd.Flags().StringP("title", "n", "", "Title of the book")
 	saveBookCmd.Flags().StringP("author", "a", "", "Author of the book")
 	saveBookCmd.Flags().IntP("units", "u", 0, "Available units")
-	saveBookCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	saveBookCmd.MarkFlagRequired("isbn")
-	saveBookCmd.MarkFlagRequired("token")
+	addTokenFlags(saveBookCmd)
+	addIdempotencyKeyFlag(saveBookCmd)
 	saveBookCmd.MarkFlagRequired("title")
 	saveBookCmd.MarkFlagRequired("author")
 	saveBookCmd.MarkFlagRequired("units")
 
+	addISBNFlags(updateBookCmd)
+	addBookUpdateFlags(updateBookCmd)
+	addTokenFlags(updateBookCmd)
 }
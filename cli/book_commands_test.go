@@ -1,11 +1,12 @@
 package cli
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
-	"io/ioutil"
 	"testing"
 
+	"github.com/mishozz/library-cli/client"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,7 +15,7 @@ type mockBookClient struct {
 	mock.Mock
 }
 
-func (m *mockBookClient) GetAllBooks(token string) (str string, err error) {
+func (m *mockBookClient) GetAllBooks(ctx context.Context, token string) (str string, err error) {
 	args := m.Called(token)
 	if args.Get(0) == nil {
 		return
@@ -22,7 +23,7 @@ func (m *mockBookClient) GetAllBooks(token string) (str string, err error) {
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockBookClient) GetBook(token, isbn string) (str string, err error) {
+func (m *mockBookClient) GetBook(ctx context.Context, token, isbn string) (str string, err error) {
 	args := m.Called(token, isbn)
 	if args.Get(0) == nil {
 		return
@@ -30,7 +31,7 @@ func (m *mockBookClient) GetBook(token, isbn string) (str string, err error) {
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockBookClient) SaveBook(token, isbn, title, author string, availableUnits uint) (str string, err error) {
+func (m *mockBookClient) SaveBook(ctx context.Context, token, isbn, title, author string, availableUnits uint) (str string, err error) {
 	args := m.Called(token, isbn, title, author, availableUnits)
 	if args.Get(0) == nil {
 		return
@@ -38,44 +39,202 @@ func (m *mockBookClient) SaveBook(token, isbn, title, author string, availableUn
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockBookClient) Delete(token, isbn string) error {
+func (m *mockBookClient) Delete(ctx context.Context, token, isbn string) error {
 	args := m.Called(token, isbn)
 	return args.Error(0)
 }
 
+func (m *mockBookClient) ListBooks(ctx context.Context, token string) ([]client.BookDetails, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]client.BookDetails), args.Error(1)
+}
+
+func (m *mockBookClient) FindBook(ctx context.Context, token, isbn string) (*client.BookDetails, error) {
+	args := m.Called(token, isbn)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*client.BookDetails), args.Error(1)
+}
+
+func (m *mockBookClient) SearchBooks(ctx context.Context, token string, query client.BookQuery) ([]client.BookDetails, error) {
+	args := m.Called(token, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]client.BookDetails), args.Error(1)
+}
+
+func (m *mockBookClient) UpdateBook(ctx context.Context, token, isbn string, update client.BookUpdate) (*client.BookDetails, error) {
+	args := m.Called(token, isbn, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*client.BookDetails), args.Error(1)
+}
+
+func (m *mockBookClient) StreamBooks(ctx context.Context, token string, query client.BookQuery, each func(book client.BookDetails) error) error {
+	args := m.Called(token, query)
+	if books, ok := args.Get(0).([]client.BookDetails); ok {
+		for _, book := range books {
+			if err := each(book); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
 func Test_GetBooksCmd(t *testing.T) {
+	books := []client.BookDetails{
+		{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 12},
+		{Isbn: "456", Title: "100% Bai Ganyo", Author: "Aleko Konstantinov", AvailableUnits: 0, Extra: map[string]json.RawMessage{"year": json.RawMessage("1895")}},
+	}
 	tests := []struct {
 		name           string
 		mockBookClient func(m *mockBookClient) *mockBookClient
+		flags          map[string]string
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
-			m.On("GetAllBooks", mock.Anything).Return("books", nil)
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		expectedOutput: `ISBN   TITLE            AUTHOR               UNITS
+123    Pod igoto        Ivan Vazov           12
+456    100% Bai Ganyo   Aleko Konstantinov   0
+`,
+	}, {
+		name: "wide",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		flags: map[string]string{"output": "wide", "no-headers": "true"},
+		expectedOutput: `123   Pod igoto        Ivan Vazov           12
+456   100% Bai Ganyo   Aleko Konstantinov   0    1895
+`,
+	}, {
+		name: "json",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books[:1], nil)
+			return m
+		},
+		flags: map[string]string{"output": "json"},
+		expectedOutput: `[
+  {
+    "Isbn": "123",
+    "Title": "Pod igoto",
+    "Author": "Ivan Vazov",
+    "AvailableUnits": 12
+  }
+]
+`,
+	}, {
+		name: "yaml with fields",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		flags:          map[string]string{"output": "yaml", "fields": "title,year"},
+		expectedOutput: "- Title: Pod igoto\n  year: null\n- Title: \"100% Bai Ganyo\"\n  year: 1895\n",
+	}, {
+		name: "csv",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		flags:          map[string]string{"output": "csv", "fields": "isbn,available_units"},
+		expectedOutput: "isbn,units\n123,12\n456,0\n",
+	}, {
+		name: "ndjson",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		flags:          map[string]string{"output": "ndjson", "fields": "isbn"},
+		expectedOutput: "{\"Isbn\":\"123\"}\n{\"Isbn\":\"456\"}\n",
+	}, {
+		name:           "unknown output format",
+		mockBookClient: func(m *mockBookClient) *mockBookClient { return m },
+		flags:          map[string]string{"output": "xml"},
+		expectedError:  `unknown output format "xml", valid formats are: table, wide, json, yaml, csv, ndjson, go-template=..., go-template-file=... and jsonpath=...`,
+	}, {
+		name: "go-template",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		flags:          map[string]string{"output": `go-template={{range .}}{{.Isbn}} {{.AvailableUnits}}{{"\n"}}{{end}}`},
+		expectedOutput: "123 12\n456 0\n",
+	}, {
+		name: "jsonpath",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books, nil)
+			return m
+		},
+		flags:          map[string]string{"output": "jsonpath={.[?(@.AvailableUnits > 0)].Title}"},
+		expectedOutput: "Pod igoto",
+	}, {
+		name:           "invalid template",
+		mockBookClient: func(m *mockBookClient) *mockBookClient { return m },
+		flags:          map[string]string{"output": "go-template={{.Isbn"},
+		expectedError:  "invalid template: template: output:1: unclosed action",
+	}, {
+		name: "unknown field",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SearchBooks", mock.Anything, client.BookQuery{}).Return(books[:1], nil)
 			return m
 		},
-		expectedOutput: "books",
+		flags:         map[string]string{"fields": "price"},
+		expectedError: `unknown field "price", valid fields are: isbn, title, author, units`,
 	}, {
 		name: "error while fetching books",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
-			m.On("GetAllBooks", mock.Anything).Return("", errors.New("error"))
+			m.On("SearchBooks", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+			return m
+		},
+		expectedError: "Unable to fetch books from library",
+	}, {
+		name: "filters",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			available := true
+			m.On("SearchBooks", mock.Anything, client.BookQuery{Author: "vazov", Available: &available, SortBy: "title", Reverse: true, Limit: 10, Offset: 20}).Return(books[:1], nil)
 			return m
 		},
-		expectedOutput: "Unable to fetch books from library",
+		flags: map[string]string{
+			"author": "vazov", "available": "true", "sort-by": "title", "reverse": "true", "limit": "10", "offset": "20", "no-headers": "true",
+		},
+		expectedOutput: "123   Pod igoto   Ivan Vazov   12\n",
+	}, {
+		name:           "available and out of stock",
+		mockBookClient: func(m *mockBookClient) *mockBookClient { return m },
+		flags:          map[string]string{"available": "true", "out-of-stock": "true"},
+		expectedError:  "--available and --out-of-stock can not be used together",
+	}, {
+		name:           "invalid sort key",
+		mockBookClient: func(m *mockBookClient) *mockBookClient { return m },
+		flags:          map[string]string{"sort-by": "price"},
+		expectedError:  `invalid --sort-by "price", valid values are: isbn, title, author, units`,
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockBookClient{}
 			getAllBooksCmd := NewGetBooksCmd(tt.mockBookClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
+			addOutputFlags(getAllBooksCmd.Flags())
+			addBookQueryFlags(getAllBooksCmd)
+			for name, value := range tt.flags {
+				getAllBooksCmd.Flags().Set(name, value)
 			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -84,35 +243,53 @@ func Test_GetBookCmd(t *testing.T) {
 	tests := []struct {
 		name           string
 		mockBookClient func(m *mockBookClient) *mockBookClient
+		flags          map[string]string
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
-			m.On("GetBook", mock.Anything, mock.Anything).Return("book", nil)
+			m.On("FindBook", mock.Anything, mock.Anything).Return(&client.BookDetails{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 12}, nil)
+			return m
+		},
+		expectedOutput: "ISBN   TITLE       AUTHOR       UNITS\n123    Pod igoto   Ivan Vazov   12\n",
+	}, {
+		name: "json object",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("FindBook", mock.Anything, mock.Anything).Return(&client.BookDetails{Isbn: "123", Title: "Pod igoto"}, nil)
 			return m
 		},
-		expectedOutput: "book",
+		flags:          map[string]string{"output": "json", "fields": "isbn,title"},
+		expectedOutput: "{\n  \"Isbn\": \"123\",\n  \"Title\": \"Pod igoto\"\n}\n",
 	}, {
 		name: "error while fetching books",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
-			m.On("GetBook", mock.Anything, mock.Anything).Return("", errors.New("error"))
+			m.On("FindBook", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to fetch book with isbn  from library",
+		expectedError: "Unable to fetch book with isbn 9780306406157 from library",
+	}, {
+		name: "book not found",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("FindBook", mock.Anything, mock.Anything).Return(nil, &client.APIError{StatusCode: 404, Message: "book not found"})
+			return m
+		},
+		expectedError: "Unable to fetch book with isbn 9780306406157 from library: book not found (404 Not Found)",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockBookClient{}
 			getBookCmd := NewGetBookCmd(tt.mockBookClient(m))
-			b := bytes.NewBufferString("")
-			getBookCmd.SetOut(b)
-			getBookCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
+			addISBNFlags(getBookCmd)
+			getBookCmd.Flags().Set("isbn", testISBN)
+			addOutputFlags(getBookCmd.Flags())
+			for name, value := range tt.flags {
+				getBookCmd.Flags().Set(name, value)
 			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			out, err := execute(getBookCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -122,6 +299,7 @@ func Test_SaveBookCmd(t *testing.T) {
 		name           string
 		mockBookClient func(m *mockBookClient) *mockBookClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
@@ -135,21 +313,18 @@ func Test_SaveBookCmd(t *testing.T) {
 			m.On("SaveBook", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("", errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to save book with isbn ",
+		expectedError: "Unable to save book with isbn 9780306406157",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockBookClient{}
 			saveBookCmd := NewSaveBookCmd(tt.mockBookClient(m))
-			b := bytes.NewBufferString("")
-			saveBookCmd.SetOut(b)
-			saveBookCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			addISBNFlags(saveBookCmd)
+			saveBookCmd.Flags().Set("isbn", testISBN)
+			out, err := execute(saveBookCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -159,34 +334,111 @@ func Test_DeleteBookCmd(t *testing.T) {
 		name           string
 		mockBookClient func(m *mockBookClient) *mockBookClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
 			m.On("Delete", mock.Anything, mock.Anything).Return(nil)
 			return m
 		},
-		expectedOutput: "Book with isbn  successfully deleted",
+		expectedOutput: "Book with isbn 9780306406157 successfully deleted",
 	}, {
 		name: "error while fetching books",
 		mockBookClient: func(m *mockBookClient) *mockBookClient {
 			m.On("Delete", mock.Anything, mock.Anything).Return(errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to delete book with isbn ",
+		expectedError: "Unable to delete book with isbn 9780306406157",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockBookClient{}
 			deleteBookCmd := NewDeleteBookCmd(tt.mockBookClient(m))
-			b := bytes.NewBufferString("")
-			deleteBookCmd.SetOut(b)
-			deleteBookCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
+			addISBNFlags(deleteBookCmd)
+			deleteBookCmd.Flags().Set("isbn", testISBN)
+			out, err := execute(deleteBookCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
+		})
+	}
+}
+
+func Test_UpdateBookCmd(t *testing.T) {
+	title := "Pod igoto"
+	units := uint(3)
+	updated := &client.BookDetails{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 3}
+	tests := []struct {
+		name           string
+		mockBookClient func(m *mockBookClient) *mockBookClient
+		flags          map[string]string
+		expectedOutput string
+		expectedError  string
+	}{{
+		name: "title",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("UpdateBook", mock.Anything, "9780306406157", client.BookUpdate{Title: &title}).Return(updated, nil)
+			return m
+		},
+		flags:          map[string]string{"title": "Pod igoto"},
+		expectedOutput: "ISBN   TITLE       AUTHOR       UNITS\n123    Pod igoto   Ivan Vazov   3\n",
+	}, {
+		name: "units",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("UpdateBook", mock.Anything, "9780306406157", client.BookUpdate{AvailableUnits: &units}).Return(updated, nil)
+			return m
+		},
+		flags:          map[string]string{"units": "3", "output": "jsonpath={.AvailableUnits}"},
+		expectedOutput: "3",
+	}, {
+		name: "remove units",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("UpdateBook", mock.Anything, "9780306406157", client.BookUpdate{AddUnits: -2}).Return(updated, nil)
+			return m
+		},
+		flags:          map[string]string{"remove-units": "2", "no-headers": "true"},
+		expectedOutput: "123   Pod igoto   Ivan Vazov   3\n",
+	}, {
+		name:           "nothing to update",
+		mockBookClient: func(m *mockBookClient) *mockBookClient { return m },
+		expectedError:  "nothing to update, set --title, --author, --units, --add-units or --remove-units",
+	}, {
+		name:           "units and add units",
+		mockBookClient: func(m *mockBookClient) *mockBookClient { return m },
+		flags:          map[string]string{"units": "3", "add-units": "1"},
+		expectedError:  "only one of --units, --add-units and --remove-units can be set",
+	}, {
+		name: "changed in the meantime",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("UpdateBook", mock.Anything, "9780306406157", mock.Anything).Return(nil, client.ErrBookChanged)
+			return m
+		},
+		flags:         map[string]string{"author": "Vazov"},
+		expectedError: "Unable to update book with isbn 9780306406157: the book was changed by someone else in the meantime",
+	}, {
+		name: "not found",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("UpdateBook", mock.Anything, "9780306406157", mock.Anything).Return(nil, &client.APIError{StatusCode: 404, Message: "book not found"})
+			return m
+		},
+		flags:         map[string]string{"author": "Vazov"},
+		expectedError: "Unable to update book with isbn 9780306406157: book not found (404 Not Found)",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockBookClient{}
+			updateBookCmd := NewUpdateBookCmd(tt.mockBookClient(m))
+			addISBNFlags(updateBookCmd)
+			updateBookCmd.Flags().Set("isbn", testISBN)
+			addBookUpdateFlags(updateBookCmd)
+			addOutputFlags(updateBookCmd.Flags())
+			for name, value := range tt.flags {
+				updateBookCmd.Flags().Set(name, value)
 			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			out, err := execute(updateBookCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/isbn"
+	"github.com/mishozz/library-cli/yaml"
+)
+
+// bookFileFormats are the formats of the files read by import
+var bookFileFormats = []string{outputCSV, outputJSON, outputNDJSON}
+
+// exportFormats are the formats of the files written by export
+var exportFormats = []string{outputCSV, outputJSON, outputNDJSON, outputYAML}
+
+// bookFields are the fields of a book which can be mapped to csv columns,
+// the fields which are not optional must have a column
+var bookFields = []struct {
+	name     string
+	optional bool
+}{
+	{name: "isbn"},
+	{name: "title"},
+	{name: "author"},
+	{name: "units", optional: true},
+}
+
+// bookRow is a book read from a file, err is set when the row can not be used
+type bookRow struct {
+	// row is the position of the book in the file starting at 1
+	row  int
+	book client.BookDetails
+	err  error
+}
+
+// bookFileFormat returns the format given with --format or the one of the file extension, a .gz extension is skipped
+func bookFileFormat(format, path string, formats []string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz"))) {
+		case ".csv":
+			format = outputCSV
+		case ".json":
+			format = outputJSON
+		case ".ndjson", ".jsonl":
+			format = outputNDJSON
+		case ".yaml", ".yml":
+			format = outputYAML
+		}
+	}
+	if format == "" {
+		return "", fmt.Errorf("unable to tell the format of %s from its extension, set --format to one of %s",
+			path, strings.Join(formats, ", "))
+	}
+	for _, f := range formats {
+		if f == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, valid formats are: %s", format, strings.Join(formats, ", "))
+}
+
+// readBooks reads the books of a file in the format. columns maps the fields of
+// the books to the headers of the csv columns, the headers named like the fields are used for the rest.
+func readBooks(r io.Reader, format string, columns map[string]string) ([]bookRow, error) {
+	switch format {
+	case outputCSV:
+		return readCSVBooks(r, columns)
+	case outputJSON:
+		return readJSONBooks(r)
+	}
+	return readNDJSONBooks(r)
+}
+
+func readCSVBooks(r io.Reader, columns map[string]string) ([]bookRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// spreadsheets often start csv files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	indexes, err := columnIndexes(header, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []bookRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := bookRow{row: len(rows) + 1}
+		cell := func(field string) string {
+			if i, ok := indexes[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.book = client.BookDetails{Isbn: cell("isbn"), Title: cell("title"), Author: cell("author")}
+		if units := cell("units"); units != "" {
+			n, err := strconv.ParseUint(units, 10, 32)
+			if err != nil {
+				row.err = fmt.Errorf("units must be a whole number, not %q", units)
+			}
+			row.book.AvailableUnits = uint(n)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// columnIndexes returns the index of the csv column of every book field
+func columnIndexes(header []string, columns map[string]string) (map[string]int, error) {
+	indexes := map[string]int{}
+	for _, field := range bookFields {
+		want, mapped := columns[field.name]
+		if !mapped {
+			want = field.name
+		}
+		for i, h := range header {
+			if fieldKey(h) == fieldKey(want) || (!mapped && field.name == "units" && fieldKey(h) == "availableunits") {
+				indexes[field.name] = i
+				break
+			}
+		}
+		if _, ok := indexes[field.name]; !ok && (mapped || !field.optional) {
+			return nil, fmt.Errorf("the csv has no column %q for the %s of the books, its columns are: %s",
+				want, field.name, strings.Join(header, ", "))
+		}
+	}
+	return indexes, nil
+}
+
+// findBookField returns the name of the book field matching s in any case
+func findBookField(s string) (string, bool) {
+	key := fieldKey(s)
+	if key == "availableunits" {
+		key = "units"
+	}
+	for _, field := range bookFields {
+		if field.name == key {
+			return field.name, true
+		}
+	}
+	return "", false
+}
+
+func readJSONBooks(r io.Reader) ([]bookRow, error) {
+	var books []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&books); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("the file must hold a json array of books: %v", err)
+	}
+	rows := make([]bookRow, len(books))
+	for i, data := range books {
+		rows[i] = decodeBookRow(i+1, data)
+	}
+	return rows, nil
+}
+
+func readNDJSONBooks(r io.Reader) ([]bookRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var rows []bookRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		rows = append(rows, decodeBookRow(len(rows)+1, line))
+	}
+	return rows, scanner.Err()
+}
+
+func decodeBookRow(n int, data []byte) bookRow {
+	row := bookRow{row: n}
+	if err := json.Unmarshal(data, &row.book); err != nil {
+		row.err = fmt.Errorf("not a book: %v", err)
+	}
+	return row
+}
+
+// checkBook returns the book of the row with its isbn normalized when validate is set,
+// or why it can not be saved
+func checkBook(row bookRow, validate bool) (client.BookDetails, error) {
+	book := row.book
+	book.Isbn = strings.TrimSpace(book.Isbn)
+	if row.err != nil {
+		return book, row.err
+	}
+	if validate {
+		parsed, err := isbn.Parse(book.Isbn)
+		if err != nil {
+			return book, err
+		}
+		book.Isbn = parsed.String()
+	}
+	switch {
+	case book.Isbn == "":
+		return book, errors.New("the isbn is empty")
+	case strings.TrimSpace(book.Title) == "":
+		return book, errors.New("the title is empty")
+	case strings.TrimSpace(book.Author) == "":
+		return book, errors.New("the author is empty")
+	}
+	return book, nil
+}
+
+// parseColumns returns the --columns mapping of the book fields, e.g. "AvailableUnits" becomes "units"
+func parseColumns(columns map[string]string) (map[string]string, error) {
+	keys := make([]string, 0, len(columns))
+	for key := range columns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mapping := map[string]string{}
+	for _, key := range keys {
+		field, ok := findBookField(key)
+		if !ok {
+			names := make([]string, len(bookFields))
+			for i, f := range bookFields {
+				names[i] = f.name
+			}
+			return nil, fmt.Errorf("unknown field %q in --columns, valid fields are: %s", key, strings.Join(names, ", "))
+		}
+		mapping[field] = columns[key]
+	}
+	return mapping, nil
+}
+
+// bookWriter writes books to a file one at a time, close finishes the file
+type bookWriter interface {
+	write(book client.BookDetails) error
+	close() error
+}
+
+// newBookWriter returns a writer of one of the exportFormats. The books are written
+// like get-all prints them with -o, only the csv has just the columns known to the cli.
+func newBookWriter(w io.Writer, format string) bookWriter {
+	switch format {
+	case outputCSV:
+		return &csvBookWriter{w: csv.NewWriter(w)}
+	case outputNDJSON:
+		return &ndjsonBookWriter{w: w}
+	case outputYAML:
+		return &yamlBookWriter{w: w}
+	}
+	return &jsonBookWriter{w: w}
+}
+
+type csvBookWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (c *csvBookWriter) header() {
+	if !c.started {
+		headers := make([]string, len(bookColumns))
+		for i, column := range bookColumns {
+			headers[i] = column.name
+		}
+		c.w.Write(headers)
+		c.started = true
+	}
+}
+
+func (c *csvBookWriter) write(book client.BookDetails) error {
+	c.header()
+	record := make([]string, len(bookColumns))
+	for i, column := range bookColumns {
+		record[i] = column.text(book)
+	}
+	c.w.Write(record)
+	return c.w.Error()
+}
+
+func (c *csvBookWriter) close() error {
+	c.header()
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonBookWriter writes an indented json array
+type jsonBookWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonBookWriter) write(book client.BookDetails) error {
+	data, err := marshalJSON(book, false)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if j.count == 0 {
+		buf.WriteString("[\n  ")
+	} else {
+		buf.WriteString(",\n  ")
+	}
+	if err := json.Indent(&buf, bytes.TrimSpace(data), "  ", "  "); err != nil {
+		return err
+	}
+	j.count++
+	_, err = j.w.Write(buf.Bytes())
+	return err
+}
+
+func (j *jsonBookWriter) close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+type ndjsonBookWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonBookWriter) write(book client.BookDetails) error {
+	data, err := marshalJSON(book, false)
+	if err != nil {
+		return err
+	}
+	_, err = n.w.Write(data)
+	return err
+}
+
+func (n *ndjsonBookWriter) close() error {
+	return nil
+}
+
+// yamlBookWriter writes a yaml sequence with an item for every book
+type yamlBookWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (y *yamlBookWriter) write(book client.BookDetails) error {
+	data, err := yaml.Marshal([]client.BookDetails{book})
+	if err != nil {
+		return err
+	}
+	y.count++
+	_, err = y.w.Write(data)
+	return err
+}
+
+func (y *yamlBookWriter) close() error {
+	if y.count == 0 {
+		_, err := io.WriteString(y.w, "[]\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/isbn"
+	"github.com/spf13/cobra"
+)
+
+// catalogFormats are the formats of the catalog files read by plan, apply and diff.
+// yaml is only written by the cli, reading it needs a full yaml parser.
+var catalogFormats = []string{outputJSON}
+
+// Actions of the changes in a plan
+const (
+	planCreate = "create"
+	planUpdate = "update"
+	planDelete = "delete"
+)
+
+// Statuses of the changes made by apply
+const (
+	applyDone    = "done"
+	applyFailed  = "failed"
+	applyNotSent = "not-sent"
+)
+
+// change is a step of the plan which makes the library match the catalog
+type change struct {
+	Action string `json:"Action"`
+	Isbn   string `json:"Isbn"`
+	// Changes describes the fields of the book which are created, changed or deleted
+	Changes string `json:"Changes"`
+	// Loans is how many copies of a book which would be deleted are taken by users
+	Loans  int    `json:"Loans,omitempty"`
+	Status string `json:"Status,omitempty"`
+	Error  string `json:"Error,omitempty"`
+
+	book   client.BookDetails
+	update client.BookUpdate
+}
+
+var planColumns = []column{
+	{name: "action", header: "ACTION", key: "Action", text: func(item interface{}) string { return item.(change).Action }},
+	{name: "isbn", header: "ISBN", key: "Isbn", text: func(item interface{}) string { return item.(change).Isbn }},
+	{name: "changes", header: "CHANGES", key: "Changes", text: func(item interface{}) string {
+		c := item.(change)
+		if c.Loans > 0 {
+			return fmt.Sprintf("%s (%d on loan)", c.Changes, c.Loans)
+		}
+		return c.Changes
+	}},
+}
+
+var applyColumns = []column{
+	planColumns[0],
+	planColumns[1],
+	{name: "status", header: "STATUS", key: "Status", text: func(item interface{}) string { return item.(change).Status }},
+	{name: "error", header: "ERROR", key: "Error", text: func(item interface{}) string { return item.(change).Error }},
+}
+
+// catalogBook is a book of the catalog file, units is false when the file leaves its units alone
+type catalogBook struct {
+	book  client.BookDetails
+	units bool
+}
+
+// plan is what has to change so that the library holds the books of the catalog
+type plan struct {
+	changes   []change
+	unchanged int
+	// kept is how many books are not in the catalog and stay because --prune is not set
+	kept int
+}
+
+// NewPlanCmd returns cobra command for showing how the library differs from a catalog file
+func NewPlanCmd(bookClient client.BookClient, userClient client.UserClient) *cobra.Command {
+	return &cobra.Command{
+		Use:         "plan",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Show the changes which make the library match a catalog file",
+		Long: `Show the changes which make the library match a catalog file, without making them
+
+The catalog is a json list of books like the output of export or get-all -o json.
+Books which are not in the library are created and the title, author and units of the others
+are updated. Books without AvailableUnits in the catalog keep the units they have in the library.
+With --prune the books which are not in the catalog are deleted, unless users have taken them.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			catalog, err := readCatalog(cmd)
+			if err != nil {
+				return err
+			}
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			pl, err := makePlan(cmd, bookClient, userClient, token, catalog)
+			if err != nil {
+				return err
+			}
+			if err := p.print(cmd.OutOrStdout(), planColumns, changeItems(pl.changes), false); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), pl.summary())
+			return pl.loansError()
+		},
+	}
+}
+
+// NewApplyCmd returns cobra command for making the library match a catalog file
+func NewApplyCmd(bookClient client.BookClient, userClient client.UserClient) *cobra.Command {
+	return &cobra.Command{
+		Use:         "apply",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Make the library match a catalog file",
+		Long: `Make the library match a catalog file by making the changes shown by plan
+
+The plan is shown on stderr and the changes are only made after answering yes, or with --yes.
+Nothing is changed when books which would be deleted by --prune are taken by users.
+Books are created with save, changed with update and deleted with delete, one after another,
+and a report with the status of every change is printed at the end.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			catalog, err := readCatalog(cmd)
+			if err != nil {
+				return err
+			}
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			pl, err := makePlan(cmd, bookClient, userClient, token, catalog)
+			if err != nil {
+				return err
+			}
+			stderr := cmd.ErrOrStderr()
+			if len(pl.changes) > 0 {
+				(&printer{format: outputTable}).print(stderr, planColumns, changeItems(pl.changes), false)
+			}
+			fmt.Fprintln(stderr, pl.summary())
+			if err := pl.loansError(); err != nil {
+				return err
+			}
+			if len(pl.changes) == 0 {
+				return nil
+			}
+			if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+				if err := confirm(cmd, fmt.Sprintf("Apply %d changes to the library of profile %s? [y/N] ", len(pl.changes), currentProfile())); err != nil {
+					return err
+				}
+			}
+
+			pl.apply(cmd, bookClient, token)
+			if err := p.print(cmd.OutOrStdout(), applyColumns, changeItems(pl.changes), false); err != nil {
+				return err
+			}
+			return pl.applyError()
+		},
+	}
+}
+
+// addCatalogFlags adds the flags shared by plan and apply
+func addCatalogFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("file", "f", "", "Json file with the books the library should hold")
+	cmd.Flags().Bool("prune", false, "Delete the books which are not in the file")
+	cmd.Flags().Bool("no-isbn-validation", false, "Use the isbns of the file as they are instead of checking them and removing hyphens")
+	cmd.MarkFlagRequired("file")
+}
+
+// readCatalog reads the books of the -f file
+func readCatalog(cmd *cobra.Command) ([]catalogBook, error) {
+	path, _ := cmd.Flags().GetString("file")
+	if err := checkCatalogFormat(path); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the catalog: %w", err)
+	}
+	noValidation, _ := cmd.Flags().GetBool("no-isbn-validation")
+	books, err := decodeCatalog(data, !noValidation)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the catalog %s: %w", path, err)
+	}
+	return books, nil
+}
+
+// checkCatalogFormat refuses catalog files which are not json by their extension
+func checkCatalogFormat(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return usageError(fmt.Errorf("%s is yaml, which can not be read yet, use a json list of books like the output of export --format json", path))
+	}
+	if _, err := bookFileFormat("", path, catalogFormats); err != nil {
+		return usageError(err)
+	}
+	return nil
+}
+
+// decodeCatalog decodes a json list of books and checks them like import does
+func decodeCatalog(data []byte, validate bool) ([]catalogBook, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("the catalog must hold a list of books, not a json %s", typeErr.Value)
+		}
+		return nil, fmt.Errorf("the catalog must hold a list of books: %v", err)
+	}
+
+	books := make([]catalogBook, len(items))
+	rows := map[string]int{}
+	for i, item := range items {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(item, &fields); err != nil {
+			return nil, fmt.Errorf("book %d: not a book: %v", i+1, err)
+		}
+		for key, value := range fields {
+			field, ok := findBookField(key)
+			if ok && field == "units" {
+				books[i].units = true
+			}
+			// an isbn may be written as a number like 9780306406157
+			if ok && field != "units" && len(value) > 0 && (value[0] == '-' || value[0] >= '0' && value[0] <= '9') {
+				fields[key] = json.RawMessage(strconv.Quote(string(value)))
+			}
+		}
+		data, _ := json.Marshal(fields)
+		book, err := checkBook(decodeBookRow(i+1, data), validate)
+		if err != nil {
+			return nil, fmt.Errorf("book %d: %v", i+1, err)
+		}
+		if row, ok := rows[isbnKey(book.Isbn)]; ok {
+			return nil, fmt.Errorf("book %d: the isbn %s is also the isbn of book %d", i+1, book.Isbn, row)
+		}
+		rows[isbnKey(book.Isbn)] = i + 1
+		books[i].book = book
+	}
+	return books, nil
+}
+
+// isbnKey returns the isbn without hyphens when it is valid, so books stored with
+// hyphens before the cli removed them match the books of the catalog
+func isbnKey(s string) string {
+	if parsed, err := isbn.Parse(s); err == nil {
+		return parsed.String()
+	}
+	return strings.TrimSpace(s)
+}
+
+// makePlan compares the catalog with the books of the library. The users are only read
+// when books are deleted, to count how many of their copies are on loan.
+func makePlan(cmd *cobra.Command, bookClient client.BookClient, userClient client.UserClient, token string, catalog []catalogBook) (*plan, error) {
+	ctx, cancel := requestContext(cmd)
+	defer cancel()
+	books, err := bookClient.ListBooks(ctx, token)
+	if err != nil {
+		return nil, failure(err, "Unable to get books", "")
+	}
+
+	pl := &plan{}
+	library := map[string]client.BookDetails{}
+	for _, book := range books {
+		library[isbnKey(book.Isbn)] = book
+	}
+	for _, entry := range catalog {
+		key := isbnKey(entry.book.Isbn)
+		current, ok := library[key]
+		if !ok {
+			pl.changes = append(pl.changes, change{Action: planCreate, Isbn: entry.book.Isbn, Changes: describeBook(entry.book), book: entry.book})
+			continue
+		}
+		delete(library, key)
+		if c, ok := updateOf(current, entry); ok {
+			pl.changes = append(pl.changes, c)
+		} else {
+			pl.unchanged++
+		}
+	}
+
+	prune, _ := cmd.Flags().GetBool("prune")
+	loans := map[string]int{}
+	if prune && len(library) > 0 {
+		users, err := userClient.ListUsers(ctx, token)
+		if err != nil {
+			return nil, failure(err, "Unable to get the users to check the loans of the books to delete", "")
+		}
+		for _, user := range users {
+			for _, book := range user.TakenBooks {
+				loans[isbnKey(book.Isbn)]++
+			}
+		}
+	}
+	for _, book := range books {
+		key := isbnKey(book.Isbn)
+		if _, ok := library[key]; !ok {
+			continue
+		}
+		if !prune {
+			pl.kept++
+			continue
+		}
+		pl.changes = append(pl.changes, change{Action: planDelete, Isbn: book.Isbn, Changes: describeBook(book), Loans: loans[key], book: book})
+	}
+	return pl, nil
+}
+
+// updateOf returns the update of the book in the library to the book in the catalog
+func updateOf(current client.BookDetails, entry catalogBook) (change, bool) {
+	c := change{Action: planUpdate, Isbn: current.Isbn, book: entry.book}
+	// apply stops when the book changed after it was planned
+	c.update.Expected = &current
+	var changes []string
+	if entry.book.Title != current.Title {
+		c.update.Title = &entry.book.Title
+		changes = append(changes, fmt.Sprintf("title %q -> %q", current.Title, entry.book.Title))
+	}
+	if entry.book.Author != current.Author {
+		c.update.Author = &entry.book.Author
+		changes = append(changes, fmt.Sprintf("author %q -> %q", current.Author, entry.book.Author))
+	}
+	if entry.units && entry.book.AvailableUnits != current.AvailableUnits {
+		c.update.AvailableUnits = &entry.book.AvailableUnits
+		changes = append(changes, fmt.Sprintf("units %d -> %d", current.AvailableUnits, entry.book.AvailableUnits))
+	}
+	c.Changes = strings.Join(changes, ", ")
+	return c, len(changes) > 0
+}
+
+func describeBook(book client.BookDetails) string {
+	return fmt.Sprintf("title %q, author %q, units %d", book.Title, book.Author, book.AvailableUnits)
+}
+
+func changeItems(changes []change) []interface{} {
+	items := make([]interface{}, len(changes))
+	for i, c := range changes {
+		items[i] = c
+	}
+	return items
+}
+
+// summary counts the changes of the plan by action
+func (pl *plan) summary() string {
+	counts := map[string]int{}
+	for _, c := range pl.changes {
+		counts[c.Action]++
+	}
+	summary := fmt.Sprintf("Plan: %d to create, %d to update, %d to delete, %d unchanged",
+		counts[planCreate], counts[planUpdate], counts[planDelete], pl.unchanged)
+	if pl.kept > 0 {
+		summary += fmt.Sprintf(", %d not in the catalog are kept (use --prune to delete them)", pl.kept)
+	}
+	return summary
+}
+
+// loansError refuses a plan which deletes books that users have taken
+func (pl *plan) loansError() error {
+	var loaned []string
+	for _, c := range pl.changes {
+		if c.Action == planDelete && c.Loans > 0 {
+			loaned = append(loaned, c.Isbn)
+		}
+	}
+	if len(loaned) == 0 {
+		return nil
+	}
+	sort.Strings(loaned)
+	return &exitError{
+		code: exitCodeConflict,
+		err: fmt.Errorf("%d books which would be deleted are on loan: %s, they have to be returned or added to the catalog first",
+			len(loaned), strings.Join(loaned, ", ")),
+	}
+}
+
+// apply makes the changes one after another, an interrupted apply leaves the rest not sent
+func (pl *plan) apply(cmd *cobra.Command, bookClient client.BookClient, token string) {
+	for i := range pl.changes {
+		pl.changes[i].Status = applyNotSent
+	}
+	for i := range pl.changes {
+		if ctx := cmd.Context(); ctx != nil && ctx.Err() != nil {
+			return
+		}
+		c := &pl.changes[i]
+		if err := applyChange(cmd, bookClient, token, *c); err != nil {
+			c.Status, c.Error = applyFailed, err.Error()
+		} else {
+			c.Status = applyDone
+		}
+	}
+}
+
+func applyChange(cmd *cobra.Command, bookClient client.BookClient, token string, c change) error {
+	ctx, cancel := requestContext(cmd)
+	defer cancel()
+	var err error
+	var action string
+	switch c.Action {
+	case planCreate:
+		action = "Unable to save the book"
+		_, err = bookClient.SaveBook(ctx, token, c.book.Isbn, c.book.Title, c.book.Author, c.book.AvailableUnits)
+	case planUpdate:
+		action = "Unable to update the book"
+		_, err = bookClient.UpdateBook(ctx, token, c.Isbn, c.update)
+		if errors.Is(err, client.ErrBookChanged) {
+			return fmt.Errorf("%s: %w", action, err)
+		}
+	case planDelete:
+		action = "Unable to delete the book"
+		err = bookClient.Delete(ctx, token, c.Isbn)
+	}
+	if err != nil {
+		return failure(err, action, err.Error())
+	}
+	return nil
+}
+
+// applyError returns an error when some of the changes were not made
+func (pl *plan) applyError() error {
+	failed := 0
+	for _, c := range pl.changes {
+		if c.Status != applyDone {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes were not applied, run plan to see what is left", failed, len(pl.changes))
+	}
+	return nil
+}
+
+// confirm asks the question on stderr and returns an error unless the answer read from stdin is yes
+func confirm(cmd *cobra.Command, question string) error {
+	fmt.Fprint(cmd.ErrOrStderr(), question)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	if err == io.EOF && answer == "" {
+		fmt.Fprintln(cmd.ErrOrStderr())
+	}
+	return errors.New("Nothing was changed, answer yes or use --yes to apply the changes")
+}
+
+func init() {
+	planCmd := NewPlanCmd(client.Books, client.Users)
+	applyCmd := NewApplyCmd(client.Books, client.Users)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+	for _, cmd := range []*cobra.Command{planCmd, applyCmd} {
+		addCatalogFlags(cmd)
+		addTokenFlags(cmd)
+	}
+	applyCmd.Flags().BoolP("yes", "y", false, "Apply the changes without asking")
+}
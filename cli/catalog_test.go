@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// libraryBooks are the books of the library the catalogs of the tests are compared with
+var libraryBooks = []client.BookDetails{
+	{Isbn: "9780306406157", Title: "Dune", Author: "Frank Herbert", AvailableUnits: 3},
+	// stored with hyphens by an older cli
+	{Isbn: "0-306-40615-2", Title: "Emma", Author: "Jane Austen", AvailableUnits: 1},
+	{Isbn: "123", Title: "Old", Author: "Nobody"},
+}
+
+const testCatalog = `[
+  {"Isbn": "978-0-306-40615-7", "Title": "Dune", "Author": "Frank Herbert"},
+  {"Isbn": "0306406152", "Title": "Emma.", "Author": "Jane Austen", "AvailableUnits": 2},
+  {"Isbn": "9780131103627", "Title": "The C Programming Language", "Author": "Kernighan", "AvailableUnits": 1}
+]
+`
+
+// catalogCmd returns plan or apply with their flags reading the catalog from a temporary file
+func catalogCmd(t *testing.T, newCmd func(client.BookClient, client.UserClient) *cobra.Command,
+	m *mockBookClient, u *mockUserClient, file, catalog string) (*cobra.Command, *bytes.Buffer) {
+	path := filepath.Join(t.TempDir(), file)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(catalog), 0600))
+	cmd := newCmd(m, u)
+	addCatalogFlags(cmd)
+	addOutputFlags(cmd.Flags())
+	cmd.Flags().Set("file", path)
+	stderr := &bytes.Buffer{}
+	cmd.SetErr(stderr)
+	return cmd, stderr
+}
+
+func Test_PlanCmd(t *testing.T) {
+	tests := []struct {
+		name           string
+		file           string
+		catalog        string
+		flags          map[string]string
+		users          []client.User
+		expectedOutput string
+		expectedStderr string
+		expectedError  string
+	}{{
+		name:    "json",
+		file:    "catalog.json",
+		catalog: testCatalog,
+		expectedOutput: "ACTION   ISBN            CHANGES\n" +
+			"update   0-306-40615-2   title \"Emma\" -> \"Emma.\", units 1 -> 2\n" +
+			"create   9780131103627   title \"The C Programming Language\", author \"Kernighan\", units 1\n",
+		expectedStderr: "Plan: 1 to create, 1 to update, 0 to delete, 1 unchanged, 1 not in the catalog are kept (use --prune to delete them)\n",
+	}, {
+		name:           "json with prune",
+		file:           "catalog.json",
+		catalog:        `[{"isbn": "9780306406157", "title": "Dune", "author": "Frank Herbert", "AvailableUnits": 3}, {"Isbn": "0306406152", "Title": "Emma", "Author": "Jane Austen"}]`,
+		flags:          map[string]string{"prune": "true", "output": "ndjson"},
+		users:          []client.User{{Email: "misho@gmail.com", TakenBooks: []client.BookDetails{{Isbn: "9780306406157"}}}},
+		expectedOutput: `{"Action":"delete","Isbn":"123","Changes":"title \"Old\", author \"Nobody\", units 0"}` + "\n",
+		expectedStderr: "Plan: 0 to create, 0 to update, 1 to delete, 2 unchanged\n",
+	}, {
+		name:    "prune books on loan",
+		file:    "catalog.json",
+		catalog: `[]`,
+		flags:   map[string]string{"prune": "true", "fields": "isbn,changes"},
+		users: []client.User{
+			{Email: "misho@gmail.com", TakenBooks: []client.BookDetails{{Isbn: "123"}, {Isbn: "0306406152"}}},
+			{Email: "ivan@gmail.com", TakenBooks: []client.BookDetails{{Isbn: "123"}}},
+		},
+		expectedOutput: "ISBN            CHANGES\n" +
+			"9780306406157   title \"Dune\", author \"Frank Herbert\", units 3\n" +
+			"0-306-40615-2   title \"Emma\", author \"Jane Austen\", units 1 (1 on loan)\n" +
+			"123             title \"Old\", author \"Nobody\", units 0 (2 on loan)\n",
+		expectedStderr: "Plan: 0 to create, 0 to update, 3 to delete, 0 unchanged\n",
+		expectedError:  "2 books which would be deleted are on loan: 0-306-40615-2, 123, they have to be returned or added to the catalog first",
+	}, {
+		name:          "yaml",
+		file:          "catalog.yml",
+		catalog:       "- Isbn: 9780306406157\n",
+		expectedError: "catalog.yml is yaml, which can not be read yet, use a json list of books like the output of export --format json",
+	}, {
+		name:          "twice the same isbn",
+		file:          "catalog.json",
+		catalog:       `[{"Isbn": 9780306406157, "Title": "Dune", "Author": "Frank Herbert"}, {"Isbn": "978-0-306-40615-7", "Title": "Dune", "Author": "Frank Herbert"}]`,
+		expectedError: "Unable to read the catalog catalog.json: book 2: the isbn 9780306406157 is also the isbn of book 1",
+	}, {
+		name:          "invalid book",
+		file:          "catalog.json",
+		catalog:       `[{"Isbn": "9780306406158", "Title": "Dune", "Author": "Frank Herbert"}]`,
+		expectedError: "Unable to read the catalog catalog.json: book 1: invalid isbn \"9780306406158\": the check digit should be 7",
+	}, {
+		name:          "not a list",
+		file:          "catalog.json",
+		catalog:       `{"books": []}`,
+		expectedError: "Unable to read the catalog catalog.json: the catalog must hold a list of books, not a json object",
+	}, {
+		name:          "unknown extension",
+		file:          "catalog.csv",
+		catalog:       "isbn,title,author\n",
+		expectedError: "unknown format \"csv\", valid formats are: json",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockBookClient{}
+			m.On("ListBooks", testToken).Return(libraryBooks, nil)
+			u := &mockUserClient{}
+			u.On("ListUsers", testToken).Return(tt.users, nil)
+			planCmd, stderr := catalogCmd(t, NewPlanCmd, m, u, tt.file, tt.catalog)
+			for name, value := range tt.flags {
+				planCmd.Flags().Set(name, value)
+			}
+
+			out, err := execute(planCmd)
+			dir := filepath.Dir(planCmd.Flag("file").Value.String())
+			assertError(t, strings.ReplaceAll(tt.expectedError, tt.file, filepath.Join(dir, tt.file)), err)
+			assert.Equal(t, tt.expectedOutput, out)
+			assert.Equal(t, tt.expectedStderr, stderr.String())
+		})
+	}
+}
+
+func Test_ApplyCmd(t *testing.T) {
+	emma := "Emma."
+	units := uint(2)
+	update := client.BookUpdate{Title: &emma, AvailableUnits: &units, Expected: &libraryBooks[1]}
+	tests := []struct {
+		name           string
+		stdin          string
+		flags          map[string]string
+		mockBookClient func(m *mockBookClient)
+		expectedOutput string
+		expectedError  string
+	}{{
+		name:  "confirmed",
+		stdin: "yes\n",
+		flags: map[string]string{"prune": "true"},
+		mockBookClient: func(m *mockBookClient) {
+			m.On("UpdateBook", testToken, "0-306-40615-2", update).Return(&client.BookDetails{}, nil)
+			m.On("SaveBook", testToken, "9780131103627", "The C Programming Language", "Kernighan", uint(1)).Return("success", nil)
+			m.On("Delete", testToken, "123").Return(&client.APIError{StatusCode: 404, Message: "book not found"})
+		},
+		expectedOutput: "ACTION   ISBN            STATUS   ERROR\n" +
+			"update   0-306-40615-2   done\n" +
+			"create   9780131103627   done\n" +
+			"delete   123             failed   Unable to delete the book: book not found (404 Not Found)\n",
+		expectedError: "1 of 3 changes were not applied, run plan to see what is left",
+	}, {
+		name:  "with --yes",
+		flags: map[string]string{"yes": "true", "output": "ndjson"},
+		mockBookClient: func(m *mockBookClient) {
+			m.On("UpdateBook", testToken, "0-306-40615-2", update).Return(nil, client.ErrBookChanged)
+			m.On("SaveBook", testToken, "9780131103627", "The C Programming Language", "Kernighan", uint(1)).Return("success", nil)
+		},
+		expectedOutput: `{"Action":"update","Isbn":"0-306-40615-2","Changes":"title \"Emma\" -> \"Emma.\", units 1 -> 2","Status":"failed","Error":"Unable to update the book: the book was changed by someone else in the meantime"}` + "\n" +
+			`{"Action":"create","Isbn":"9780131103627","Changes":"title \"The C Programming Language\", author \"Kernighan\", units 1","Status":"done"}` + "\n",
+		expectedError: "1 of 2 changes were not applied, run plan to see what is left",
+	}, {
+		name:          "declined",
+		stdin:         "n\n",
+		expectedError: "Nothing was changed, answer yes or use --yes to apply the changes",
+	}, {
+		name:          "no answer",
+		expectedError: "Nothing was changed, answer yes or use --yes to apply the changes",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockBookClient{}
+			m.On("ListBooks", testToken).Return(libraryBooks, nil)
+			if tt.mockBookClient != nil {
+				tt.mockBookClient(m)
+			}
+			u := &mockUserClient{}
+			u.On("ListUsers", testToken).Return([]client.User{}, nil)
+			applyCmd, stderr := catalogCmd(t, NewApplyCmd, m, u, "catalog.json", testCatalog)
+			applyCmd.Flags().BoolP("yes", "y", false, "Apply the changes without asking")
+			applyCmd.SetIn(strings.NewReader(tt.stdin))
+			for name, value := range tt.flags {
+				applyCmd.Flags().Set(name, value)
+			}
+
+			out, err := execute(applyCmd)
+			assertError(t, tt.expectedError, err)
+			assert.Equal(t, tt.expectedOutput, out)
+			assert.Contains(t, stderr.String(), "update   0-306-40615-2   title \"Emma\" -> \"Emma.\", units 1 -> 2\n")
+			if yes, _ := applyCmd.Flags().GetBool("yes"); yes {
+				assert.NotContains(t, stderr.String(), "[y/N]")
+			} else {
+				assert.Contains(t, stderr.String(), "changes to the library of profile default? [y/N] ")
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ApplyCmd_Unchanged(t *testing.T) {
+	m := &mockBookClient{}
+	m.On("ListBooks", testToken).Return(libraryBooks[:1], nil)
+	applyCmd, stderr := catalogCmd(t, NewApplyCmd, m, &mockUserClient{}, "catalog.json",
+		`[{"Isbn": "978-0-306-40615-7", "Title": "Dune", "Author": "Frank Herbert"}]`)
+	applyCmd.Flags().Set("prune", "true")
+
+	out, err := execute(applyCmd)
+	assert.Nil(t, err)
+	assert.Equal(t, "", out)
+	assert.Equal(t, "Plan: 0 to create, 0 to update, 0 to delete, 1 unchanged\n", stderr.String())
+	m.AssertNotCalled(t, "SaveBook", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -1,6 +1,9 @@
 package cli
 
-import "github.com/stretchr/testify/mock"
+import (
+	"github.com/mishozz/library-cli/client"
+	"github.com/stretchr/testify/mock"
+)
 
 func ExampleNewSaveBookCmd() {
 	mock := func(m *mockBookClient) *mockBookClient {
@@ -9,6 +12,8 @@ func ExampleNewSaveBookCmd() {
 	}
 	m := &mockBookClient{}
 	saveBookCmd := NewSaveBookCmd(mock(m))
+	addISBNFlags(saveBookCmd)
+	saveBookCmd.Flags().Set("isbn", testISBN)
 	saveBookCmd.Execute()
 	// Output:
 	// success
@@ -21,57 +26,77 @@ func ExampleNewDeleteBookCmd() {
 	}
 	m := &mockBookClient{}
 	deleteBookCmd := NewDeleteBookCmd(mock(m))
+	addISBNFlags(deleteBookCmd)
+	deleteBookCmd.Flags().Set("isbn", testISBN)
 	deleteBookCmd.Execute()
 	// Output:
-	// Book with isbn  successfully deleted
+	// Book with isbn 9780306406157 successfully deleted
 }
 
 func ExampleNewGetBookCmd() {
 	mock := func(m *mockBookClient) *mockBookClient {
-		m.On("GetBook", mock.Anything, mock.Anything).Return("success", nil)
+		m.On("FindBook", mock.Anything, mock.Anything).Return(&client.BookDetails{Isbn: "123456", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 12}, nil)
 		return m
 	}
 	m := &mockBookClient{}
 	getBookCmd := NewGetBookCmd(mock(m))
+	addISBNFlags(getBookCmd)
+	getBookCmd.Flags().Set("isbn", testISBN)
 	getBookCmd.Execute()
 	// Output:
-	// success
+	// ISBN     TITLE       AUTHOR       UNITS
+	// 123456   Pod igoto   Ivan Vazov   12
 }
 
 func ExampleNewGetUserCmd() {
 	mock := func(m *mockUserClient) *mockUserClient {
-		m.On("GetUser", mock.Anything, mock.Anything).Return("success", nil)
+		m.On("FindUser", mock.Anything, mock.Anything).Return(&client.User{Email: "misho@gmail.com", Role: "User"}, nil)
 		return m
 	}
 	m := &mockUserClient{}
 	getUserCmd := NewGetUserCmd(mock(m))
+	addEmailFlag(getUserCmd)
+	getUserCmd.Flags().Set("email", "misho@gmail.com")
 	getUserCmd.Execute()
 	// Output:
-	// success
+	// EMAIL             ROLE   BOOKS
+	// misho@gmail.com   User   0
 }
 
 func ExampleNewGetUsersCmd() {
 	mock := func(m *mockUserClient) *mockUserClient {
-		m.On("GetAllUsers", mock.Anything).Return("success", nil)
+		m.On("SearchUsers", mock.Anything, mock.Anything).Return([]client.User{{Email: "misho@gmail.com", Role: "Admin"}}, nil)
 		return m
 	}
 	m := &mockUserClient{}
 	getUserCmd := NewGetUsersCmd(mock(m))
+	addOutputFlags(getUserCmd.Flags())
+	getUserCmd.Flags().Set("output", "json")
 	getUserCmd.Execute()
 	// Output:
-	// success
+	// [
+	//   {
+	//     "Email": "misho@gmail.com",
+	//     "Role": "Admin",
+	//     "TakenBooks": []
+	//   }
+	// ]
 }
 
 func ExampleNewLoginCmd() {
 	mock := func(m *mockUserClient) *mockUserClient {
-		m.On("Login", mock.Anything, mock.Anything).Return("success", nil)
+		m.On("Authenticate", mock.Anything, mock.Anything).Return(&client.LoginResult{Token: "success"}, nil)
 		return m
 	}
 	m := &mockUserClient{}
 	loginCmd := NewLoginCmd(mock(m))
+	addEmailFlag(loginCmd)
+	addPasswordFlags(loginCmd)
+	loginCmd.Flags().Set("email", "misho@gmail.com")
+	loginCmd.Flags().Set("password", "secret")
 	loginCmd.Execute()
 	// Output:
-	// success
+	// Logged in as misho@gmail.com
 }
 
 func ExampleNewLogoutCmd() {
@@ -80,6 +105,8 @@ func ExampleNewLogoutCmd() {
 		return m
 	}
 	m := &mockUserClient{}
+	// logout deletes the stored session the other examples rely on
+	defer storeTestSession()
 	loginCmd := NewLogoutCmd(mock(m))
 	loginCmd.Execute()
 	// Output:
@@ -93,6 +120,10 @@ func ExampleNewTakeBookCmd() {
 	}
 	m := &mockUserClient{}
 	loginCmd := NewTakeBookCmd(mock(m))
+	addEmailFlag(loginCmd)
+	addLoanFlags(loginCmd)
+	loginCmd.Flags().Set("email", "misho@gmail.com")
+	loginCmd.Flags().Set("isbn", testISBN)
 	loginCmd.Execute()
 	// Output:
 	// success
@@ -105,6 +136,10 @@ func ExampleNewReturnBookCmd() {
 	}
 	m := &mockUserClient{}
 	loginCmd := NewReturnBookCmd(mock(m))
+	addEmailFlag(loginCmd)
+	addLoanFlags(loginCmd)
+	loginCmd.Flags().Set("email", "misho@gmail.com")
+	loginCmd.Flags().Set("isbn", testISBN)
 	loginCmd.Execute()
 	// Output:
 	// Successfully returned your book
@@ -117,6 +152,10 @@ func ExampleNewRegisterCmd() {
 	}
 	m := &mockUserClient{}
 	loginCmd := NewRegisterCmd(mock(m))
+	addEmailFlag(loginCmd)
+	addPasswordFlags(loginCmd)
+	loginCmd.Flags().Set("email", "misho@gmail.com")
+	loginCmd.Flags().Set("password", "secret")
 	loginCmd.Execute()
 	// Output:
 	// success
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mishozz/library-cli/config"
+	"github.com/spf13/cobra"
+)
+
+// NewConfigCmd returns cobra command for managing the config file
+//
+// cfgFile and profile point at the values of the --config and --profile flags
+func NewConfigCmd(cfgFile, profile *string) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config file",
+		Long:  "Manage the profiles stored in the config file",
+		// config commands must work even when the selected profile is broken
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+
+	configCmd.AddCommand(NewConfigViewCmd(cfgFile))
+	configCmd.AddCommand(NewConfigSetCmd(cfgFile, profile))
+	configCmd.AddCommand(NewConfigUseProfileCmd(cfgFile))
+	configCmd.AddCommand(NewConfigGetProfilesCmd(cfgFile))
+	return configCmd
+}
+
+// NewConfigViewCmd returns cobra command for printing the config file
+func NewConfigViewCmd(cfgFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "view",
+		Short: "Show the config file",
+		Long:  "Show the profiles stored in the config file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := readConfig(*cfgFile)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(cfg, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(data))
+			return nil
+		},
+	}
+}
+
+// NewConfigSetCmd returns cobra command for changing a setting of a profile
+func NewConfigSetCmd(cfgFile, profile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "Set a profile setting",
+		Long: fmt.Sprintf(`Set a setting of the selected profile, creating the profile if it does not exist.
+
+Valid settings are: %s`, strings.Join(config.Keys(), ", ")),
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, cfg, err := readConfig(*cfgFile)
+			if err != nil {
+				return err
+			}
+
+			name := cfg.SelectedProfile(*profile)
+			p, ok := cfg.Profiles[name]
+			if !ok {
+				p = &config.Profile{}
+				cfg.Profiles[name] = p
+			}
+			if err := p.Set(args[0], args[1]); err != nil {
+				return err
+			}
+			if err := cfg.Save(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Set %s of profile %s", args[0], name)
+			return nil
+		},
+	}
+}
+
+// NewConfigUseProfileCmd returns cobra command for switching the current profile
+func NewConfigUseProfileCmd(cfgFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "use-profile NAME",
+		Short: "Switch the current profile",
+		Long:  "Make the given profile the one used when --profile and LIBRARY_PROFILE are not set",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, cfg, err := readConfig(*cfgFile)
+			if err != nil {
+				return err
+			}
+			if _, ok := cfg.Profiles[args[0]]; !ok {
+				return fmt.Errorf("%w %q", config.ErrUnknownProfile, args[0])
+			}
+			cfg.CurrentProfile = args[0]
+			if err := cfg.Save(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Switched to profile %s", args[0])
+			return nil
+		},
+	}
+}
+
+// NewConfigGetProfilesCmd returns cobra command for listing the profiles
+func NewConfigGetProfilesCmd(cfgFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get-profiles",
+		Short: "List the profiles",
+		Long:  "List the profiles in the config file, the current one is marked with *",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, cfg, err := readConfig(*cfgFile)
+			if err != nil {
+				return err
+			}
+			for _, name := range cfg.ProfileNames() {
+				marker := " "
+				if name == cfg.SelectedProfile("") {
+					marker = "*"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", marker, name)
+			}
+			return nil
+		},
+	}
+}
+
+func readConfig(cfgFile string) (string, *config.Config, error) {
+	path, err := config.ResolvePath(cfgFile)
+	if err != nil {
+		return "", nil, err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, cfg, nil
+}
+
+func init() {
+	rootCmd.AddCommand(NewConfigCmd(&cfgFile, &profileName))
+}
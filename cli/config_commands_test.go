@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishozz/library-cli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConfigCmd(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "config.json")
+	profile := ""
+
+	run := func(args ...string) (string, error) {
+		configCmd := NewConfigCmd(&cfgFile, &profile)
+		b := bytes.NewBufferString("")
+		configCmd.SetOut(b)
+		configCmd.SetErr(b)
+		configCmd.SetArgs(args)
+		err := configCmd.Execute()
+		return b.String(), err
+	}
+
+	profile = "staging"
+	out, err := run("set", "base-url", "https://staging.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "Set base-url of profile staging", out)
+
+	profile = "production"
+	_, err = run("set", "timeout", "30s")
+	assert.Nil(t, err)
+
+	profile = ""
+	_, err = run("use-profile", "dev")
+	assert.NotNil(t, err)
+
+	out, err = run("use-profile", "production")
+	assert.Nil(t, err)
+	assert.Equal(t, "Switched to profile production", out)
+
+	out, err = run("get-profiles")
+	assert.Nil(t, err)
+	assert.Equal(t, "* production\n  staging\n", out)
+
+	cfg, err := config.Load(cfgFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "production", cfg.CurrentProfile)
+	assert.Equal(t, "https://staging.example.com", cfg.Profiles["staging"].BaseURL)
+}
@@ -0,0 +1,391 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/config"
+	"github.com/mishozz/library-cli/yaml"
+	"github.com/spf13/cobra"
+)
+
+// outputUnified is the -o format of diff which prints a unified diff
+const outputUnified = "unified"
+
+// Kinds of the differences between two catalogs
+const (
+	// diffMissing books are only in --from
+	diffMissing = "missing"
+	// diffExtra books are only in --to
+	diffExtra    = "extra"
+	diffMetadata = "metadata"
+	diffUnits    = "units"
+)
+
+// difference is a book which is only in one of the catalogs or a field of a book which differs
+type difference struct {
+	Isbn  string `json:"Isbn"`
+	Kind  string `json:"Kind"`
+	Field string `json:"Field,omitempty"`
+	From  string `json:"From"`
+	To    string `json:"To"`
+}
+
+var diffColumns = []column{
+	{name: "isbn", header: "ISBN", key: "Isbn", text: func(item interface{}) string { return item.(difference).Isbn }},
+	{name: "kind", header: "KIND", key: "Kind", text: func(item interface{}) string { return item.(difference).Kind }},
+	{name: "field", header: "FIELD", key: "Field", text: func(item interface{}) string { return item.(difference).Field }},
+	{name: "from", header: "FROM", key: "From", text: func(item interface{}) string { return item.(difference).From }},
+	{name: "to", header: "TO", key: "To", text: func(item interface{}) string { return item.(difference).To }},
+}
+
+// profileClient returns the book client which talks to the library REST API of a profile
+type profileClient func(cmd *cobra.Command, profile string) (client.BookClient, error)
+
+// catalogSource is a side of diff, the books of a profile or of a catalog file
+type catalogSource struct {
+	name string
+	// file is set when the books are read from a catalog file
+	file  bool
+	books []catalogBook
+}
+
+// bookPair is a book of the compared catalogs, from or to is nil when only one of them has it
+type bookPair struct {
+	from *catalogBook
+	to   *catalogBook
+}
+
+// NewDiffCmd returns cobra command for comparing the books of two profiles or of a profile and a catalog file
+func NewDiffCmd(clientFor profileClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the books of two profiles or of a profile and a catalog file",
+		Long: `Compare the books of two profiles or of a profile and a catalog file
+
+--from and --to name profiles of the config file, or json catalog files like the ones of plan.
+--from is the current profile when it is not set. The books of both are read at the same time and
+matched by isbn, and the books which are only on one side and the titles, authors and units which
+differ are printed. Books without AvailableUnits in a catalog file are compared without their units.
+
+-o unified prints a unified diff of the books as yaml sorted by isbn, the other -o formats a list of the differences.
+The command exits with code 1 when the books differ and with 2 or higher when it fails.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return diffTrouble(runDiff(cmd, clientFor))
+		},
+	}
+}
+
+// runDiff compares the catalogs of --from and --to and prints the differences
+func runDiff(cmd *cobra.Command, clientFor profileClient) error {
+	output, _ := cmd.Flags().GetString("output")
+	var p *printer
+	if output != outputUnified {
+		var err error
+		if p, err = newPrinter(cmd); err != nil {
+			return err
+		}
+	}
+	fromName, _ := cmd.Flags().GetString("from")
+	if fromName == "" {
+		fromName = currentProfile()
+	}
+	toName, _ := cmd.Flags().GetString("to")
+	from, to := newCatalogSource(fromName), newCatalogSource(toName)
+	fromToken, _ := cmd.Flags().GetString("from-token")
+	toToken, _ := cmd.Flags().GetString("to-token")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, side := range []struct {
+		source *catalogSource
+		token  string
+	}{{from, fromToken}, {to, toToken}} {
+		wg.Add(1)
+		go func(i int, source *catalogSource, token string) {
+			defer wg.Done()
+			errs[i] = source.load(cmd, clientFor, token)
+		}(i, side.source, side.token)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	pairs := pairBooks(from.books, to.books)
+	differences := differencesOf(pairs)
+	if p == nil {
+		if len(differences) > 0 {
+			writeUnifiedDiff(cmd.OutOrStdout(), from.name, to.name, pairs)
+		}
+	} else {
+		items := make([]interface{}, len(differences))
+		for i, d := range differences {
+			items[i] = d
+		}
+		if err := p.print(cmd.OutOrStdout(), diffColumns, items, false); err != nil {
+			return err
+		}
+	}
+	return diffError(from.name, to.name, differences)
+}
+
+// addDiffFlags adds the flags of the diff command
+func addDiffFlags(cmd *cobra.Command) {
+	cmd.Flags().String("from", "", "Profile or catalog file to compare (default is the current profile)")
+	cmd.Flags().String("to", "", "Profile or catalog file to compare with")
+	cmd.Flags().String("from-token", "", "Jwt token for the --from profile (default is the token stored by login --profile)")
+	cmd.Flags().String("to-token", "", "Jwt token for the --to profile (default is the token stored by login --profile)")
+	cmd.MarkFlagRequired("to")
+}
+
+// newCatalogSource returns a catalog file when the name has the extension of one, otherwise a profile.
+// A yaml file counts as a catalog file, so load refuses it instead of looking for a profile of that name.
+func newCatalogSource(name string) *catalogSource {
+	format, _ := bookFileFormat("", name, []string{outputJSON, outputYAML})
+	return &catalogSource{name: name, file: format != ""}
+}
+
+// load reads the books of the catalog file or of the library REST API of the profile
+func (s *catalogSource) load(cmd *cobra.Command, clientFor profileClient, token string) error {
+	if s.file {
+		if err := checkCatalogFormat(s.name); err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(s.name)
+		if err != nil {
+			return fmt.Errorf("Unable to read the catalog: %w", err)
+		}
+		// the isbns are compared as they are, so exported books with any isbn can be compared
+		if s.books, err = decodeCatalog(data, false); err != nil {
+			return fmt.Errorf("Unable to read the catalog %s: %w", s.name, err)
+		}
+		return nil
+	}
+
+	bookClient, err := clientFor(cmd, s.name)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		session, err := loadSessionOf(s.name)
+		if err != nil {
+			return err
+		}
+		if session == nil {
+			return &exitError{code: exitCodeAuth, err: fmt.Errorf("You need to login to profile %s first or provide its jwt token", s.name)}
+		}
+		token = session.Token
+	}
+	if token, err = checkToken(cmd, token); err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(cmd)
+	defer cancel()
+	books, err := bookClient.ListBooks(ctx, token)
+	if err != nil {
+		return failure(err, fmt.Sprintf("Unable to get the books of profile %s", s.name), "")
+	}
+	s.books = make([]catalogBook, len(books))
+	for i, book := range books {
+		s.books[i] = catalogBook{book: book, units: true}
+	}
+	return nil
+}
+
+// profileBookClient returns a book client for the library REST API of the profile with its settings.
+// The LIBRARY_* environment variables are not applied, they would point both sides at the same server.
+func profileBookClient(cmd *cobra.Command, name string) (client.BookClient, error) {
+	path, err := config.ResolvePath(cfgFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := cfg.Profile(name)
+	if err != nil {
+		return nil, usageError(err)
+	}
+	opts, err := profileOptions(name, profile)
+	if err != nil {
+		return nil, err
+	}
+	if level := debugLevel(); level > 0 {
+		opts = append(opts, client.WithMiddleware(client.Debug(cmd.ErrOrStderr(), level)))
+	}
+	endpoint := profileEndpoint(profile)
+	return client.NewBookClient(client.NewHTTPClient(opts...), &endpoint), nil
+}
+
+// pairBooks matches the books of the catalogs by isbn and sorts them by isbn.
+// A book of a catalog file without units gets the units of the other side.
+func pairBooks(from, to []catalogBook) []bookPair {
+	pairs := map[string]*bookPair{}
+	var keys []string
+	pairOf := func(book catalogBook) *bookPair {
+		key := isbnKey(book.book.Isbn)
+		if pairs[key] == nil {
+			pairs[key] = &bookPair{}
+			keys = append(keys, key)
+		}
+		return pairs[key]
+	}
+	for _, book := range from {
+		book := book
+		book.book.Extra = nil
+		pairOf(book).from = &book
+	}
+	for _, book := range to {
+		book := book
+		book.book.Extra = nil
+		pairOf(book).to = &book
+	}
+
+	sort.Strings(keys)
+	result := make([]bookPair, len(keys))
+	for i, key := range keys {
+		pair := *pairs[key]
+		if pair.from != nil && pair.to != nil {
+			if !pair.from.units {
+				pair.from.book.AvailableUnits = pair.to.book.AvailableUnits
+			}
+			if !pair.to.units {
+				pair.to.book.AvailableUnits = pair.from.book.AvailableUnits
+			}
+		}
+		result[i] = pair
+	}
+	return result
+}
+
+// differencesOf lists the books which are only in one catalog and the fields which differ
+func differencesOf(pairs []bookPair) []difference {
+	var differences []difference
+	for _, pair := range pairs {
+		switch {
+		case pair.to == nil:
+			differences = append(differences, difference{Isbn: pair.from.book.Isbn, Kind: diffMissing, From: describeBook(pair.from.book)})
+		case pair.from == nil:
+			differences = append(differences, difference{Isbn: pair.to.book.Isbn, Kind: diffExtra, To: describeBook(pair.to.book)})
+		default:
+			from, to := pair.from.book, pair.to.book
+			if from.Title != to.Title {
+				differences = append(differences, difference{Isbn: from.Isbn, Kind: diffMetadata, Field: "title", From: from.Title, To: to.Title})
+			}
+			if from.Author != to.Author {
+				differences = append(differences, difference{Isbn: from.Isbn, Kind: diffMetadata, Field: "author", From: from.Author, To: to.Author})
+			}
+			if from.AvailableUnits != to.AvailableUnits {
+				differences = append(differences, difference{Isbn: from.Isbn, Kind: diffUnits, Field: "units",
+					From: strconv.FormatUint(uint64(from.AvailableUnits), 10), To: strconv.FormatUint(uint64(to.AvailableUnits), 10)})
+			}
+		}
+	}
+	return differences
+}
+
+// writeUnifiedDiff writes the differing books as a unified diff of both catalogs printed as yaml
+func writeUnifiedDiff(w io.Writer, fromName, toName string, pairs []bookPair) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName)
+	// fromLine and toLine count the lines of the catalogs before the book
+	fromLine, toLine := 0, 0
+	for _, pair := range pairs {
+		var a, b []string
+		if pair.from != nil {
+			a = bookLines(pair.from.book)
+		}
+		if pair.to != nil {
+			b = bookLines(pair.to.book)
+		}
+		if strings.Join(a, "\n") == strings.Join(b, "\n") {
+			fromLine, toLine = fromLine+len(a), toLine+len(b)
+			continue
+		}
+
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(fromLine, len(a)), hunkRange(toLine, len(b)))
+		if len(a) == len(b) {
+			for i := range a {
+				if a[i] == b[i] {
+					fmt.Fprintln(w, " "+a[i])
+				} else {
+					fmt.Fprintln(w, "-"+a[i])
+					fmt.Fprintln(w, "+"+b[i])
+				}
+			}
+		} else {
+			for _, l := range a {
+				fmt.Fprintln(w, "-"+l)
+			}
+			for _, l := range b {
+				fmt.Fprintln(w, "+"+l)
+			}
+		}
+		fromLine, toLine = fromLine+len(a), toLine+len(b)
+	}
+}
+
+// bookLines returns the lines of the book as an item of a yaml list
+func bookLines(book client.BookDetails) []string {
+	// books which only differ in the hyphens of their isbns are the same
+	book.Isbn = isbnKey(book.Isbn)
+	data, _ := yaml.Marshal([]client.BookDetails{book})
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// hunkRange returns the start and length of a hunk, an empty hunk starts at the line before it
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// errDiffer is the cause of the error of diff when the catalogs differ
+var errDiffer = errors.New("the catalogs differ")
+
+// diffError returns an error which makes diff exit with 1 when the catalogs differ
+func diffError(fromName, toName string, differences []difference) error {
+	if len(differences) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	changed := map[string]bool{}
+	for _, d := range differences {
+		if d.Kind == diffMetadata || d.Kind == diffUnits {
+			changed[isbnKey(d.Isbn)] = true
+		} else {
+			counts[d.Kind]++
+		}
+	}
+	message := fmt.Sprintf("%s and %s differ: %d books are only in %s, %d only in %s and %d have other fields",
+		fromName, toName, counts[diffMissing], fromName, counts[diffExtra], toName, len(changed))
+	return &exitError{code: exitCodeError, message: message, err: errDiffer}
+}
+
+// diffTrouble keeps exit code 1 for catalogs which differ. Like diff(1) the failures exit with 2 or higher,
+// so the ones which other commands exit with 1 for, e.g. a broken catalog file, exit with 2.
+func diffTrouble(err error) error {
+	if err == nil || errors.Is(err, errDiffer) || exitCode(err) != exitCodeError {
+		return err
+	}
+	return &exitError{code: exitCodeUsage, err: err}
+}
+
+func init() {
+	diffCmd := NewDiffCmd(profileBookClient)
+	rootCmd.AddCommand(diffCmd)
+	addDiffFlags(diffCmd)
+}
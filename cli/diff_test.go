@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/config"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiffCmd(t *testing.T) {
+	defaultBooks := []client.BookDetails{
+		{Isbn: "9780306406157", Title: "Dune", Author: "Frank Herbert", AvailableUnits: 3},
+		{Isbn: "0306406152", Title: "Emma", Author: "Jane Austen", AvailableUnits: 1},
+	}
+	productionBooks := []client.BookDetails{
+		{Isbn: "123", Title: "Old", Author: "Nobody"},
+		{Isbn: "978-0-306-40615-7", Title: "Dune", Author: "Frank Herbert", AvailableUnits: 5},
+	}
+	tests := []struct {
+		name           string
+		flags          map[string]string
+		catalog        string
+		expectedOutput string
+		expectedError  string
+		// expectedExitCode is only checked when it is set
+		expectedExitCode int
+	}{{
+		name:  "table",
+		flags: map[string]string{"to": "production", "to-token": "productionToken"},
+		expectedOutput: "ISBN            KIND      FIELD   FROM                                          TO\n" +
+			"0306406152      missing           title \"Emma\", author \"Jane Austen\", units 1\n" +
+			"123             extra                                                           title \"Old\", author \"Nobody\", units 0\n" +
+			"9780306406157   units     units   3                                             5\n",
+		expectedError: "default and production differ: 1 books are only in default, 1 only in production and 1 have other fields",
+	}, {
+		name:  "unified",
+		flags: map[string]string{"to": "production", "to-token": "productionToken", "output": "unified"},
+		expectedOutput: `--- default
++++ production
+@@ -1,4 +0,0 @@
+-- Isbn: "0306406152"
+-  Title: Emma
+-  Author: Jane Austen
+-  AvailableUnits: 1
+@@ -4,0 +1,4 @@
++- Isbn: "123"
++  Title: Old
++  Author: Nobody
++  AvailableUnits: 0
+@@ -5,4 +5,4 @@
+ - Isbn: "9780306406157"
+   Title: Dune
+   Author: Frank Herbert
+-  AvailableUnits: 3
++  AvailableUnits: 5
+`,
+		expectedError: "default and production differ: 1 books are only in default, 1 only in production and 1 have other fields",
+	}, {
+		name:           "profile and catalog file",
+		flags:          map[string]string{"from": "production", "from-token": "productionToken", "output": "ndjson"},
+		catalog:        `[{"Isbn": 9780306406157, "Title": "Dune", "Author": "F. Herbert"}, {"Isbn": 123, "Title": "Old", "Author": "Nobody"}]`,
+		expectedOutput: `{"Isbn":"978-0-306-40615-7","Kind":"metadata","Field":"author","From":"Frank Herbert","To":"F. Herbert"}` + "\n",
+		expectedError:  "production and catalog.json differ: 0 books are only in production, 0 only in catalog.json and 1 have other fields",
+	}, {
+		name:    "same books",
+		flags:   map[string]string{"output": "unified"},
+		catalog: `[{"Isbn": "0-306-40615-2", "Title": "Emma", "Author": "Jane Austen"}, {"Isbn": "9780306406157", "Title": "Dune", "Author": "Frank Herbert", "AvailableUnits": 3}]`,
+	}, {
+		name:             "not logged in",
+		flags:            map[string]string{"to": "production"},
+		expectedError:    "You need to login to profile production first or provide its jwt token",
+		expectedExitCode: exitCodeAuth,
+	}, {
+		name:             "unknown profile",
+		flags:            map[string]string{"to": "staging"},
+		expectedError:    `unknown profile "staging"`,
+		expectedExitCode: exitCodeUsage,
+	}, {
+		name:             "broken catalog file",
+		catalog:          `[{"Isbn": "9780306406157"`,
+		expectedError:    "Unable to read the catalog catalog.json: the catalog must hold a list of books: unexpected end of JSON input",
+		expectedExitCode: exitCodeUsage,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			books := map[string]*mockBookClient{"default": {}, "production": {}}
+			books["default"].On("ListBooks", testToken).Return(defaultBooks, nil)
+			books["production"].On("ListBooks", "productionToken").Return(productionBooks, nil)
+			clientFor := func(cmd *cobra.Command, profile string) (client.BookClient, error) {
+				if m, ok := books[profile]; ok {
+					return m, nil
+				}
+				return nil, usageError(errors.New(`unknown profile "` + profile + `"`))
+			}
+
+			diffCmd := NewDiffCmd(clientFor)
+			addDiffFlags(diffCmd)
+			addOutputFlags(diffCmd.Flags())
+			dir := t.TempDir()
+			for name, value := range tt.flags {
+				diffCmd.Flags().Set(name, value)
+			}
+			if tt.catalog != "" {
+				path := filepath.Join(dir, "catalog.json")
+				assert.Nil(t, ioutil.WriteFile(path, []byte(tt.catalog), 0600))
+				diffCmd.Flags().Set("to", path)
+			}
+
+			out, err := execute(diffCmd)
+			assert.Equal(t, replacePath(tt.expectedOutput, "catalog.json", dir), out)
+			assertError(t, replacePath(tt.expectedError, "catalog.json", dir), err)
+			if tt.expectedOutput != "" {
+				assert.Equal(t, exitCodeError, exitCode(err))
+			}
+			if tt.expectedExitCode != 0 {
+				assert.Equal(t, tt.expectedExitCode, exitCode(err))
+			}
+		})
+	}
+}
+
+// Test_DiffCmd_IgnoresEnvironment checks that LIBRARY_BASE_URL, which CI sets for the other commands,
+// does not point both profiles at the same server
+func Test_DiffCmd_IgnoresEnvironment(t *testing.T) {
+	serve := func(books string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(books))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	staging := serve(`[{"Isbn": "9780306406157", "Title": "Dune", "Author": "Frank Herbert", "AvailableUnits": 3}]`)
+	production := serve(`[{"Isbn": "9780306406157", "Title": "Dune", "Author": "Frank Herbert", "AvailableUnits": 5}]`)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := &config.Config{Profiles: map[string]*config.Profile{
+		"staging":    {BaseURL: staging.URL},
+		"production": {BaseURL: production.URL},
+	}}
+	assert.Nil(t, cfg.Save(path))
+	previous := cfgFile
+	cfgFile = path
+	os.Setenv(config.EnvBaseURL, staging.URL)
+	t.Cleanup(func() {
+		cfgFile = previous
+		os.Unsetenv(config.EnvBaseURL)
+	})
+
+	diffCmd := NewDiffCmd(profileBookClient)
+	addDiffFlags(diffCmd)
+	addOutputFlags(diffCmd.Flags())
+	for name, value := range map[string]string{"from": "staging", "from-token": "stagingToken", "to": "production", "to-token": "productionToken", "output": "ndjson"} {
+		diffCmd.Flags().Set(name, value)
+	}
+
+	out, err := execute(diffCmd)
+	assert.Equal(t, `{"Isbn":"9780306406157","Kind":"units","Field":"units","From":"3","To":"5"}`+"\n", out)
+	assertError(t, "staging and production differ: 0 books are only in staging, 0 only in production and 1 have other fields", err)
+	assert.Equal(t, exitCodeError, exitCode(err))
+}
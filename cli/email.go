@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"github.com/mishozz/library-cli/emailaddr"
+	"github.com/spf13/cobra"
+)
+
+// addEmailFlag adds the required -e to a command which works with one user
+func addEmailFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("email", "e", "", "Set your email")
+	cmd.MarkFlagRequired("email")
+}
+
+// emailFlag returns the address given with -e, canonicalized with the
+// email-canonicalization of the profile. Invalid addresses are refused before any request is sent.
+func emailFlag(cmd *cobra.Command) (string, error) {
+	value, _ := cmd.Flags().GetString("email")
+	rules, err := emailaddr.ParseRules(current.profile.EmailCanonicalization)
+	if err != nil {
+		return "", err
+	}
+	email, err := emailaddr.Normalize(value, rules)
+	if err != nil {
+		return "", usageError(err)
+	}
+	return email, nil
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EmailFlag(t *testing.T) {
+	tests := []struct {
+		name             string
+		email            string
+		canonicalization string
+		expected         string
+		err              string
+	}{
+		{name: "default canonicalization", email: testEmail, expected: "Misho+Books@gmail.com"},
+		{name: "lowercase", email: testEmail, canonicalization: "trim,lowercase", expected: "misho+books@gmail.com"},
+		{name: "none", email: "Misho@Gmail.COM", canonicalization: "none", expected: "Misho@Gmail.COM"},
+		{name: "idn", email: "hans@bücher.example", canonicalization: "ascii-domain", expected: "hans@xn--bcher-kva.example"},
+		{name: "invalid", email: "misho@gmail..com", err: `invalid email "misho@gmail..com": the domain can not start or end with a dot or have two dots in a row`},
+		{name: "empty", email: "", err: `invalid email "": it has no @`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			current.profile.EmailCanonicalization = tt.canonicalization
+			t.Cleanup(func() { current.profile.EmailCanonicalization = "" })
+			cmd := &cobra.Command{}
+			addEmailFlag(cmd)
+			cmd.Flags().Set("email", tt.email)
+
+			email, err := emailFlag(cmd)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Equal(t, exitCodeUsage, exitCode(err))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, email)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/mishozz/library-cli/client"
+)
+
+// Exit codes of the cli
+const (
+	exitCodeError     = 1
+	exitCodeUsage     = 2
+	exitCodeAuth      = 3
+	exitCodeForbidden = 4
+	exitCodeNotFound  = 5
+	exitCodeConflict  = 6
+	exitCodeNetwork   = 7
+	exitCodeServer    = 8
+	exitCodeTimeout   = 9
+	// exitCodeInterrupted follows the shell convention of 128 + SIGINT
+	exitCodeInterrupted = 130
+)
+
+// errorKinds names the exit codes in the json error reports
+var errorKinds = map[int]string{
+	exitCodeError:       "error",
+	exitCodeUsage:       "usage",
+	exitCodeAuth:        "auth",
+	exitCodeForbidden:   "forbidden",
+	exitCodeNotFound:    "not-found",
+	exitCodeConflict:    "conflict",
+	exitCodeNetwork:     "network",
+	exitCodeServer:      "server",
+	exitCodeTimeout:     "timeout",
+	exitCodeInterrupted: "interrupted",
+}
+
+// exitError is an error which makes the cli exit with a specific code
+type exitError struct {
+	code int
+	// message replaces the message of err when it is set
+	message string
+	err     error
+}
+
+func (e *exitError) Error() string {
+	if e.message != "" {
+		return e.message
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// usageError marks an error in the command line of the user
+func usageError(err error) error {
+	return &exitError{code: exitCodeUsage, err: err}
+}
+
+// classify turns err into an *exitError with the exit code which matches it
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	return &exitError{code: exitCode(err), err: err}
+}
+
+// exitCode returns the exit code of the cli for err
+func exitCode(err error) int {
+	var exitErr *exitError
+	var urlErr *url.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return exitCodeInterrupted
+	case errors.Is(err, client.UnauthorizedErr), errors.Is(err, errNoSession):
+		return exitCodeAuth
+	case errors.Is(err, client.ErrForbidden):
+		return exitCodeForbidden
+	case errors.Is(err, client.ErrNotFound):
+		return exitCodeNotFound
+	case errors.Is(err, client.ErrConflict):
+		return exitCodeConflict
+	case errors.Is(err, client.ErrServer):
+		return exitCodeServer
+	case errors.As(err, &urlErr), errors.As(err, &opErr):
+		return exitCodeNetwork
+	}
+	return exitCodeError
+}
+
+// failure returns the error of a request which failed. The message of the library REST API
+// is shown when there is one, otherwise the hint is added to the action which failed.
+func failure(err error, action, hint string) error {
+	var apiErr *client.APIError
+	var urlErr *url.Error
+	message := action
+	switch {
+	case errors.As(err, &apiErr):
+		message = action + ": " + apiErr.Description()
+	case errors.Is(err, context.DeadlineExceeded):
+		message = action + ": the library REST API did not answer in time"
+	case errors.Is(err, context.Canceled):
+		message = action + ": interrupted"
+	case errors.As(err, &urlErr):
+		message = action + ": the library REST API can not be reached: " + urlErr.Err.Error()
+	case hint != "":
+		message = action + ". " + hint
+	}
+	return &exitError{code: exitCode(err), message: message, err: err}
+}
+
+// batchError returns the error of a command which sends many requests and reports every one of them.
+// It exits with the code the failures share, e.g. 5 when every book was not found,
+// and with exitCodeError when their codes differ or nothing failed with an error.
+func batchError(message string, failures []error) error {
+	if len(failures) == 0 {
+		return errors.New(message)
+	}
+	code := exitCode(failures[0])
+	for _, err := range failures[1:] {
+		if exitCode(err) != code {
+			return errors.New(message)
+		}
+	}
+	return &exitError{code: code, message: message, err: failures[0]}
+}
+
+// errorReport is the machine readable error printed with --error-format json
+type errorReport struct {
+	Error    string `json:"error"`
+	Kind     string `json:"kind"`
+	ExitCode int    `json:"exit_code"`
+	// the fields below are only set when the library REST API answered with an error
+	Status        int    `json:"status,omitempty"`
+	ServerMessage string `json:"server_message,omitempty"`
+	Method        string `json:"method,omitempty"`
+	Path          string `json:"path,omitempty"`
+}
+
+func newErrorReport(err error) errorReport {
+	code := exitCode(err)
+	report := errorReport{Error: err.Error(), Kind: errorKinds[code], ExitCode: code}
+	if report.Kind == "" {
+		report.Kind = errorKinds[exitCodeError]
+	}
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		report.Status = apiErr.StatusCode
+		report.ServerMessage = apiErr.Message
+		report.Method = apiErr.Method
+		report.Path = apiErr.Path
+	}
+	return report
+}
+
+// reportError writes err in the chosen --error-format, hint follows the message of text reports
+func reportError(w io.Writer, format string, err error, hint string) {
+	if format == errorFormatJSON {
+		data, _ := json.Marshal(newErrorReport(err))
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	fmt.Fprintln(w, err)
+	if hint != "" {
+		fmt.Fprintln(w, hint)
+	}
+}
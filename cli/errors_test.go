@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExitCode(t *testing.T) {
+	connRefused := &url.Error{Op: "Get", URL: "http://localhost:8080/v1/books", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "plain error", err: errors.New("error"), expected: exitCodeError},
+		{name: "usage", err: usageError(errors.New("unknown field")), expected: exitCodeUsage},
+		{name: "no session", err: errNoSession, expected: exitCodeAuth},
+		{name: "unauthorized", err: &client.APIError{StatusCode: 401}, expected: exitCodeAuth},
+		{name: "forbidden", err: &client.APIError{StatusCode: 403}, expected: exitCodeForbidden},
+		{name: "not found", err: &client.APIError{StatusCode: 404}, expected: exitCodeNotFound},
+		{name: "conflict", err: &client.APIError{StatusCode: 409}, expected: exitCodeConflict},
+		{name: "bad request", err: &client.APIError{StatusCode: 400}, expected: exitCodeError},
+		{name: "book changed", err: fmt.Errorf("Unable to update book: %w", client.ErrBookChanged), expected: exitCodeConflict},
+		{name: "server", err: &client.APIError{StatusCode: 503}, expected: exitCodeServer},
+		{name: "network", err: connRefused, expected: exitCodeNetwork},
+		{name: "timeout", err: &url.Error{Op: "Get", URL: "http://localhost:8080", Err: context.DeadlineExceeded}, expected: exitCodeTimeout},
+		{name: "interrupted", err: context.Canceled, expected: exitCodeInterrupted},
+		{name: "wrapped", err: fmt.Errorf("Unable to login: %w", &client.APIError{StatusCode: 401}), expected: exitCodeAuth},
+		{name: "failure keeps the code", err: failure(connRefused, "Unable to fetch books from library", ""), expected: exitCodeNetwork},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, exitCode(tt.err))
+		})
+	}
+}
+
+func Test_Failure(t *testing.T) {
+	connRefused := &url.Error{Op: "Get", URL: "http://localhost:8080/v1/books", Err: errors.New("dial tcp: connection refused")}
+	err := failure(connRefused, "Unable to fetch books from library", "")
+	assert.EqualError(t, err, "Unable to fetch books from library: the library REST API can not be reached: dial tcp: connection refused")
+	assert.True(t, errors.Is(err, connRefused))
+}
+
+func Test_ReportError(t *testing.T) {
+	notFound := failure(&client.APIError{StatusCode: 404, Message: "book not found", Method: "GET", Path: "/v1/books/123"},
+		"Unable to fetch book with isbn 123 from library", "")
+	tests := []struct {
+		name     string
+		format   string
+		err      error
+		hint     string
+		expected string
+	}{{
+		name:     "text",
+		format:   errorFormatText,
+		err:      notFound,
+		expected: "Unable to fetch book with isbn 123 from library: book not found (404 Not Found)\n",
+	}, {
+		name:     "text with hint",
+		format:   errorFormatText,
+		err:      usageError(errors.New(`required flag(s) "isbn" not set`)),
+		hint:     "Run 'library get --help' for usage.",
+		expected: "required flag(s) \"isbn\" not set\nRun 'library get --help' for usage.\n",
+	}, {
+		name:   "json",
+		format: errorFormatJSON,
+		err:    notFound,
+		expected: `{"error":"Unable to fetch book with isbn 123 from library: book not found (404 Not Found)","kind":"not-found","exit_code":5,` +
+			`"status":404,"server_message":"book not found","method":"GET","path":"/v1/books/123"}` + "\n",
+	}, {
+		name:     "json without a response",
+		format:   errorFormatJSON,
+		err:      classify(errNoSession),
+		hint:     "ignored",
+		expected: `{"error":"You need to login first or provide your jwt token with -t","kind":"auth","exit_code":3}` + "\n",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := bytes.NewBufferString("")
+			reportError(b, tt.format, tt.err, tt.hint)
+			assert.Equal(t, tt.expected, b.String())
+		})
+	}
+}
+
+func Test_ErrorFormatFlag(t *testing.T) {
+	var format string
+	value := (*errorFormatValue)(&format)
+	assert.Nil(t, value.Set(errorFormatJSON))
+	assert.Equal(t, errorFormatJSON, format)
+	assert.EqualError(t, value.Set("xml"), "valid formats are text and json")
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// NewExportCmd returns cobra command for exporting the books to a file
+func NewExportCmd(bookClient client.BookClient) *cobra.Command {
+	return &cobra.Command{
+		Use:   "export",
+		Short: "Export the books to a csv, json, ndjson or yaml file",
+		Long: `Export the books to a csv, json, ndjson or yaml file, or to stdout without --out
+
+The books are written while they are read from the library REST API, so large catalogs are not
+held in memory unless they have to be sorted by the cli. The file is written to a temporary file
+next to it which replaces it at the end, so a failed export leaves the previous file as it was.
+The filters of get-all select the books. --timeout limits how long to wait for the next book,
+not the whole export.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			query, err := bookQuery(cmd)
+			if err != nil {
+				return err
+			}
+			path, _ := cmd.Flags().GetString("out")
+			compress, _ := cmd.Flags().GetBool("gzip")
+			compress = compress || strings.HasSuffix(path, ".gz")
+			format, _ := cmd.Flags().GetString("format")
+			if format == "" && path == "" {
+				format = outputJSON
+			}
+			if format, err = bookFileFormat(format, path, exportFormats); err != nil {
+				return usageError(err)
+			}
+
+			out, err := newExportOutput(cmd.OutOrStdout(), path, compress)
+			if err != nil {
+				return err
+			}
+			defer out.abort()
+			books := newBookWriter(out, format)
+
+			// a large catalog takes longer than --timeout, which limits the wait for the next book instead
+			ctx, cancel, touch, expired := idleContext(cmd)
+			defer cancel()
+			count := 0
+			var writeErr error
+			err = bookClient.StreamBooks(ctx, token, query, func(book client.BookDetails) error {
+				touch()
+				count++
+				writeErr = books.write(book)
+				return writeErr
+			})
+			if writeErr == nil && err == nil {
+				writeErr = books.close()
+			}
+			if writeErr == nil && err == nil {
+				writeErr = out.commit()
+			}
+			if writeErr != nil {
+				return fmt.Errorf("Unable to write the books: %w", writeErr)
+			}
+			if err != nil && expired() {
+				err = fmt.Errorf("no book arrived for %s: %w", timeout, context.DeadlineExceeded)
+			}
+			if err != nil {
+				return failure(err, "Unable to export books", "")
+			}
+			if path != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Exported %d books to %s\n", count, path)
+			}
+			return nil
+		},
+	}
+}
+
+// addExportFlags adds the flags of the export command
+func addExportFlags(cmd *cobra.Command) {
+	cmd.Flags().String("format", "", "Format of the file: "+strings.Join(exportFormats, ", ")+
+		" (default is the one of the --out extension or json)")
+	cmd.Flags().String("out", "", "File to write the books to, stdout when it is not set")
+	cmd.Flags().Bool("gzip", false, "Compress the books with gzip, the default when --out ends with .gz")
+}
+
+// exportOutput buffers and optionally compresses the export. A file is written to a temporary
+// file in the same directory which is renamed to the file by commit and removed by abort.
+type exportOutput struct {
+	*bufio.Writer
+	gzip *gzip.Writer
+	file *os.File
+	path string
+	done bool
+}
+
+func newExportOutput(stdout io.Writer, path string, compress bool) (*exportOutput, error) {
+	out := &exportOutput{path: path}
+	w := stdout
+	if path != "" {
+		f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create %s: %w", path, err)
+		}
+		// keep the permissions of the file which is replaced
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, fmt.Errorf("Unable to create %s: %w", path, err)
+		}
+		out.file, w = f, f
+	}
+	if compress {
+		out.gzip = gzip.NewWriter(w)
+		out.gzip.Name = strings.TrimSuffix(filepath.Base(path), ".gz")
+		w = out.gzip
+	}
+	out.Writer = bufio.NewWriter(w)
+	return out, nil
+}
+
+// commit flushes the books and moves the temporary file to its place
+func (o *exportOutput) commit() error {
+	if err := o.Flush(); err != nil {
+		return err
+	}
+	if o.gzip != nil {
+		if err := o.gzip.Close(); err != nil {
+			return err
+		}
+	}
+	if o.file == nil {
+		o.done = true
+		return nil
+	}
+	if err := o.file.Sync(); err != nil {
+		return err
+	}
+	if err := o.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(o.file.Name(), o.path); err != nil {
+		return err
+	}
+	o.done = true
+	return nil
+}
+
+// abort removes the temporary file unless the export was committed
+func (o *exportOutput) abort() {
+	if o.done || o.file == nil {
+		return
+	}
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
+
+func init() {
+	exportCmd := NewExportCmd(client.Books)
+	rootCmd.AddCommand(exportCmd)
+	addExportFlags(exportCmd)
+	addBookQueryFlags(exportCmd)
+	addTokenFlags(exportCmd)
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_ExportCmd(t *testing.T) {
+	books := []client.BookDetails{
+		{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 12},
+		{Isbn: "456", Title: "Bai Ganyo, part 1", Author: "Aleko Konstantinov"},
+	}
+	tests := []struct {
+		name           string
+		out            string
+		flags          map[string]string
+		books          []client.BookDetails
+		expectedOutput string
+		expectedFile   string
+		expectedError  string
+	}{{
+		name:           "csv",
+		out:            "books.csv",
+		books:          books,
+		expectedOutput: "Exported 2 books to books.csv\n",
+		expectedFile:   "isbn,title,author,units\n123,Pod igoto,Ivan Vazov,12\n456,\"Bai Ganyo, part 1\",Aleko Konstantinov,0\n",
+	}, {
+		name:  "json to stdout",
+		books: books[:1],
+		expectedOutput: `[
+  {
+    "Isbn": "123",
+    "Title": "Pod igoto",
+    "Author": "Ivan Vazov",
+    "AvailableUnits": 12
+  }
+]
+`,
+	}, {
+		name:           "empty json",
+		out:            "books.json",
+		expectedOutput: "Exported 0 books to books.json\n",
+		expectedFile:   "[]\n",
+	}, {
+		name:           "ndjson",
+		out:            "books.jsonl",
+		books:          books,
+		expectedOutput: "Exported 2 books to books.jsonl\n",
+		expectedFile: `{"Isbn":"123","Title":"Pod igoto","Author":"Ivan Vazov","AvailableUnits":12}` + "\n" +
+			`{"Isbn":"456","Title":"Bai Ganyo, part 1","Author":"Aleko Konstantinov","AvailableUnits":0}` + "\n",
+	}, {
+		name:           "yaml with format",
+		out:            "books.txt",
+		flags:          map[string]string{"format": "yaml"},
+		books:          books,
+		expectedOutput: "Exported 2 books to books.txt\n",
+		expectedFile: "- Isbn: \"123\"\n  Title: Pod igoto\n  Author: Ivan Vazov\n  AvailableUnits: 12\n" +
+			"- Isbn: \"456\"\n  Title: Bai Ganyo, part 1\n  Author: Aleko Konstantinov\n  AvailableUnits: 0\n",
+	}, {
+		name:          "unknown extension",
+		out:           "books.txt",
+		expectedError: "unable to tell the format of books.txt from its extension, set --format to one of csv, json, ndjson, yaml",
+	}, {
+		name:          "unknown format",
+		flags:         map[string]string{"format": "xml"},
+		expectedError: `unknown format "xml", valid formats are: csv, json, ndjson, yaml`,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := &mockBookClient{}
+			m.On("StreamBooks", testToken, client.BookQuery{}).Return(tt.books, nil)
+			exportCmd := NewExportCmd(m)
+			addExportFlags(exportCmd)
+			addBookQueryFlags(exportCmd)
+			for name, value := range tt.flags {
+				exportCmd.Flags().Set(name, value)
+			}
+			if tt.out != "" {
+				exportCmd.Flags().Set("out", filepath.Join(dir, tt.out))
+			}
+
+			out, err := execute(exportCmd)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, replacePath(tt.expectedError, tt.out, dir))
+				assert.Equal(t, exitCodeUsage, exitCode(err))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, replacePath(tt.expectedOutput, tt.out, dir), out)
+			if tt.out != "" {
+				data, err := ioutil.ReadFile(filepath.Join(dir, tt.out))
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedFile, string(data))
+				info, _ := os.Stat(filepath.Join(dir, tt.out))
+				assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+			}
+			if files, _ := ioutil.ReadDir(dir); tt.out != "" {
+				assert.Len(t, files, 1, "only the exported file is left")
+			}
+		})
+	}
+}
+
+func replacePath(s, file, dir string) string {
+	if file == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, file, filepath.Join(dir, file))
+}
+
+func Test_ExportCmd_Gzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.ndjson.gz")
+	m := &mockBookClient{}
+	available := true
+	m.On("StreamBooks", testToken, client.BookQuery{Author: "vazov", Available: &available}).Return([]client.BookDetails{{Isbn: "123"}}, nil)
+	exportCmd := NewExportCmd(m)
+	addExportFlags(exportCmd)
+	addBookQueryFlags(exportCmd)
+	exportCmd.Flags().Set("out", path)
+	exportCmd.Flags().Set("author", "vazov")
+	exportCmd.Flags().Set("available", "true")
+
+	_, err := execute(exportCmd)
+	assert.Nil(t, err)
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "books.ndjson", r.Name)
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Isbn":"123","Title":"","Author":"","AvailableUnits":0}`+"\n", string(data))
+}
+
+func Test_ExportCmd_KeepsFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.csv")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("yesterday\n"), 0600))
+
+	m := &mockBookClient{}
+	m.On("StreamBooks", testToken, mock.Anything).Return([]client.BookDetails{{Isbn: "123"}}, errors.New("connection reset"))
+	exportCmd := NewExportCmd(m)
+	addExportFlags(exportCmd)
+	addBookQueryFlags(exportCmd)
+	exportCmd.Flags().Set("out", path)
+
+	_, err := execute(exportCmd)
+	assert.EqualError(t, err, "Unable to export books")
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "yesterday\n", string(data))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	m = &mockBookClient{}
+	m.On("StreamBooks", testToken, mock.Anything).Return([]client.BookDetails{{Isbn: "123"}}, nil)
+	exportCmd = NewExportCmd(m)
+	addExportFlags(exportCmd)
+	addBookQueryFlags(exportCmd)
+	exportCmd.Flags().Set("out", path)
+	_, err = execute(exportCmd)
+	assert.Nil(t, err)
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the permissions of the replaced file are kept")
+}
+
+func Test_ExportCmd_Timeout(t *testing.T) {
+	// the server sends a book every 30ms and stops for stall before the last one
+	serve := func(stall time.Duration) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flusher := w.(http.Flusher)
+			w.Write([]byte("["))
+			for i := 1; i <= 4; i++ {
+				if i > 1 {
+					w.Write([]byte(","))
+				}
+				if i == 4 {
+					time.Sleep(stall)
+				}
+				fmt.Fprintf(w, `{"Isbn":"%d","Title":"Book %d","Author":"Author"}`, i, i)
+				flusher.Flush()
+				time.Sleep(30 * time.Millisecond)
+			}
+			w.Write([]byte("]"))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	previous := timeout
+	timeout = 80 * time.Millisecond
+	t.Cleanup(func() { timeout = previous })
+
+	export := func(server *httptest.Server) (string, error) {
+		bookClient := client.NewBookClient(client.NewHTTPClient(), &client.Endpoint{BaseURL: server.URL, APIVersion: "v1"})
+		exportCmd := NewExportCmd(bookClient)
+		addExportFlags(exportCmd)
+		addBookQueryFlags(exportCmd)
+		exportCmd.Flags().Set("format", "ndjson")
+		return execute(exportCmd)
+	}
+
+	// the whole export takes longer than the timeout
+	start := time.Now()
+	out, err := export(serve(0))
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) > timeout)
+	assert.Equal(t, 4, strings.Count(out, "\n"))
+
+	_, err = export(serve(200 * time.Millisecond))
+	assert.EqualError(t, err, "Unable to export books: the library REST API did not answer in time")
+	assert.Equal(t, exitCodeTimeout, exitCode(err))
+}
@@ -0,0 +1,382 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// defaultImportWorkers is how many books import saves at the same time unless --workers is set
+const defaultImportWorkers = 4
+
+// Statuses of the rows in the report of import
+const (
+	importCreated = "created"
+	importFailed  = "failed"
+	importInvalid = "invalid"
+	// importSkipped rows are in the resume file, they were created by an earlier run
+	importSkipped = "skipped"
+	// importValid rows would be created without --dry-run
+	importValid = "valid"
+	// importNotSent rows were not sent because the import was interrupted
+	importNotSent = "not-sent"
+)
+
+// importResult is the outcome of a row of the imported file
+type importResult struct {
+	Row    int    `json:"Row"`
+	Isbn   string `json:"Isbn"`
+	Status string `json:"Status"`
+	Error  string `json:"Error,omitempty"`
+	// err is the reason the row was not imported
+	err error
+}
+
+var importColumns = []column{
+	{name: "row", header: "ROW", key: "Row", text: func(item interface{}) string { return strconv.Itoa(item.(importResult).Row) }},
+	{name: "isbn", header: "ISBN", key: "Isbn", text: func(item interface{}) string { return item.(importResult).Isbn }},
+	{name: "status", header: "STATUS", key: "Status", text: func(item interface{}) string { return item.(importResult).Status }},
+	{name: "error", header: "ERROR", key: "Error", text: func(item interface{}) string { return item.(importResult).Error }},
+}
+
+// NewImportCmd returns cobra command for importing books from a file
+func NewImportCmd(bookClient client.BookClient) *cobra.Command {
+	return &cobra.Command{
+		Use:         "import FILE",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Import books from a csv, json or ndjson file",
+		Long: `Import books from a csv, json or ndjson file, or from stdin when FILE is -
+
+A csv file needs a header row with the columns isbn, title, author and optionally units,
+--columns maps the fields to other headers, e.g. --columns isbn=Code,title=Name.
+A json file holds an array of books and an ndjson file one book per line, like the output of get-all -o json.
+
+The books are saved by --workers requests at the same time and a report of every row is printed at the end.
+With --resume the isbns of the created books are written to a file and the books in it are skipped,
+so an interrupted import can be run again with the same file and continues where it stopped.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
+			imp, err := newImporter(cmd, bookClient)
+			if err != nil {
+				return err
+			}
+			rows, err := readImportFile(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			if imp.resumePath != "" {
+				if err := imp.openResumeFile(); err != nil {
+					return err
+				}
+			}
+			if imp.resume != nil {
+				defer imp.resume.Close()
+			}
+			if !imp.dryRun {
+				if imp.token, err = tokenFor(cmd); err != nil {
+					return err
+				}
+			}
+
+			results := imp.run(cmd, rows)
+			items := make([]interface{}, len(results))
+			for i, result := range results {
+				items[i] = result
+			}
+			if err := p.print(cmd.OutOrStdout(), importColumns, items, false); err != nil {
+				return err
+			}
+			return importError(results, imp)
+		},
+	}
+}
+
+// addImportFlags adds the flags of the import command
+func addImportFlags(cmd *cobra.Command) {
+	cmd.Flags().String("format", "", "Format of the file: "+strings.Join(bookFileFormats, ", ")+" (default is the one of the file extension)")
+	cmd.Flags().StringToString("columns", nil, "Csv headers of the book fields, e.g. isbn=Code,title=Name,author=Writer,units=Copies")
+	cmd.Flags().Int("workers", defaultImportWorkers, "How many books are saved at the same time")
+	cmd.Flags().Bool("dry-run", false, "Check the rows without saving any book")
+	cmd.Flags().String("resume", "", "File with the isbns of the created books, the books in it are skipped")
+	cmd.Flags().Bool("no-progress", false, "Do not draw the progress bar on stderr")
+	cmd.Flags().Bool("no-isbn-validation", false, "Send the isbns as they are given instead of checking them and removing hyphens")
+}
+
+// importer saves the rows of an import with a pool of workers
+type importer struct {
+	books      client.BookClient
+	token      string
+	workers    int
+	dryRun     bool
+	validate   bool
+	resumePath string
+	// done holds the isbns of the resume file
+	done   map[string]bool
+	resume *os.File
+
+	mu sync.Mutex
+	// resumeErr is the first error writing the resume file
+	resumeErr error
+	progress  *progress
+}
+
+func newImporter(cmd *cobra.Command, bookClient client.BookClient) (*importer, error) {
+	imp := &importer{books: bookClient, done: map[string]bool{}}
+	imp.workers, _ = cmd.Flags().GetInt("workers")
+	imp.dryRun, _ = cmd.Flags().GetBool("dry-run")
+	imp.resumePath, _ = cmd.Flags().GetString("resume")
+	noValidation, _ := cmd.Flags().GetBool("no-isbn-validation")
+	imp.validate = !noValidation
+	if imp.workers < 1 {
+		return nil, usageError(errors.New("--workers must be at least 1"))
+	}
+
+	noProgress, _ := cmd.Flags().GetBool("no-progress")
+	if stderr, ok := cmd.ErrOrStderr().(*os.File); ok && !noProgress && isTerminal(stderr.Fd()) {
+		imp.progress = &progress{w: stderr}
+	}
+	return imp, nil
+}
+
+// readImportFile reads the rows of FILE, or of stdin when it is -
+func readImportFile(cmd *cobra.Command, path string) ([]bookRow, error) {
+	format, _ := cmd.Flags().GetString("format")
+	if path == "-" {
+		if err := stdinFree(cmd, "import -"); err != nil {
+			return nil, err
+		}
+	}
+	if path == "-" && format == "" {
+		return nil, usageError(fmt.Errorf("set --format to one of %s when reading from stdin", strings.Join(bookFileFormats, ", ")))
+	}
+	format, err := bookFileFormat(format, path, bookFileFormats)
+	if err != nil {
+		return nil, usageError(err)
+	}
+	flagColumns, _ := cmd.Flags().GetStringToString("columns")
+	columns, err := parseColumns(flagColumns)
+	if err != nil {
+		return nil, usageError(err)
+	}
+
+	in := cmd.InOrStdin()
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the books: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	rows, err := readBooks(in, format, columns)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the books from %s: %w", path, err)
+	}
+	return rows, nil
+}
+
+// openResumeFile reads the isbns of the resume file and opens it to add the books created by this run
+func (imp *importer) openResumeFile() error {
+	f, err := os.Open(imp.resumePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to read the resume file: %w", err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				imp.done[line] = true
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("Unable to read the resume file: %w", err)
+		}
+	}
+
+	if imp.dryRun {
+		// a dry run only skips the books of the resume file
+		return nil
+	}
+	if imp.resume, err = os.OpenFile(imp.resumePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return fmt.Errorf("Unable to open the resume file: %w", err)
+	}
+	return nil
+}
+
+// run checks the rows and saves the valid ones which are not in the resume file
+func (imp *importer) run(cmd *cobra.Command, rows []bookRow) []importResult {
+	results := make([]importResult, len(rows))
+	var pending []int
+	for i, row := range rows {
+		book, err := checkBook(row, imp.validate)
+		results[i] = importResult{Row: row.row, Isbn: book.Isbn}
+		switch {
+		case err != nil:
+			results[i].Status, results[i].Error, results[i].err = importInvalid, err.Error(), err
+		case imp.done[book.Isbn]:
+			results[i].Status = importSkipped
+		case imp.dryRun:
+			results[i].Status = importValid
+		default:
+			results[i].Status = importNotSent
+			rows[i].book = book
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return results
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	imp.progress.start(len(pending))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < imp.workers && w < len(pending); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = imp.save(cmd, rows[i].book, results[i])
+				imp.progress.add(results[i].Status == importCreated)
+			}
+		}()
+	}
+feed:
+	for _, i := range pending {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	imp.progress.finish()
+	return results
+}
+
+// save saves the book and adds its isbn to the resume file when it is created
+func (imp *importer) save(cmd *cobra.Command, book client.BookDetails, result importResult) importResult {
+	ctx, cancel := requestContext(cmd)
+	defer cancel()
+	if _, err := imp.books.SaveBook(ctx, imp.token, book.Isbn, book.Title, book.Author, book.AvailableUnits); err != nil {
+		// Ctrl-C leaves the book to --resume like the ones which were not sent yet
+		if errors.Is(err, context.Canceled) {
+			return result
+		}
+		result.Status, result.err = importFailed, failure(err, "Unable to save the book", err.Error())
+		result.Error = result.err.Error()
+		return result
+	}
+	result.Status = importCreated
+
+	if imp.resume != nil {
+		imp.mu.Lock()
+		if _, err := fmt.Fprintln(imp.resume, book.Isbn); err != nil && imp.resumeErr == nil {
+			imp.resumeErr = err
+		}
+		imp.mu.Unlock()
+	}
+	return result
+}
+
+// importError returns an error when some of the rows were not imported,
+// with the exit code of the failed requests when they all share it
+func importError(results []importResult, imp *importer) error {
+	if imp.resumeErr != nil {
+		return fmt.Errorf("Unable to write the resume file: %w", imp.resumeErr)
+	}
+	counts := map[string]int{}
+	var failures []error
+	for _, result := range results {
+		counts[result.Status]++
+		if result.err != nil {
+			failures = append(failures, result.err)
+		}
+	}
+	if imp.dryRun {
+		if counts[importInvalid] > 0 {
+			return fmt.Errorf("%d of %d books are invalid", counts[importInvalid], len(results))
+		}
+		return nil
+	}
+	if notImported := counts[importFailed] + counts[importInvalid] + counts[importNotSent]; notImported > 0 {
+		hint := ""
+		if imp.resumePath == "" {
+			hint = ", run it again with --resume to skip the books which were created"
+		}
+		return batchError(fmt.Sprintf("%d of %d books were not imported%s", notImported, len(results), hint), failures)
+	}
+	return nil
+}
+
+// progress draws a progress bar of the import on a terminal, a nil progress draws nothing
+type progress struct {
+	w       io.Writer
+	mu      sync.Mutex
+	total   int
+	created int
+	failed  int
+}
+
+const progressWidth = 30
+
+func (p *progress) start(total int) {
+	if p == nil {
+		return
+	}
+	p.total = total
+	p.draw()
+}
+
+func (p *progress) add(created bool) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if created {
+		p.created++
+	} else {
+		p.failed++
+	}
+	p.draw()
+}
+
+func (p *progress) draw() {
+	done := p.created + p.failed
+	filled := progressWidth * done / p.total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	fmt.Fprintf(p.w, "\r[%s] %d/%d, %d created, %d failed", bar, done, p.total, p.created, p.failed)
+}
+
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	fmt.Fprintln(p.w)
+}
+
+func init() {
+	importCmd := NewImportCmd(client.Books)
+	rootCmd.AddCommand(importCmd)
+	addImportFlags(importCmd)
+	addTokenFlags(importCmd)
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_ImportCmd(t *testing.T) {
+	tests := []struct {
+		name           string
+		file           string
+		content        string
+		flags          map[string]string
+		mockBookClient func(m *mockBookClient) *mockBookClient
+		expectedOutput string
+		expectedError  string
+		// expectedExitCode is only checked when it is set
+		expectedExitCode int
+	}{{
+		name:    "csv",
+		file:    "books.csv",
+		content: "isbn,title,author,units\n978-0-306-40615-7,Dune,Frank Herbert,3\n0-306-40615-2,Emma,Jane Austen,\n",
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SaveBook", testToken, "9780306406157", "Dune", "Frank Herbert", uint(3)).Return("success", nil)
+			m.On("SaveBook", testToken, "0306406152", "Emma", "Jane Austen", uint(0)).Return("success", nil)
+			return m
+		},
+		expectedOutput: "ROW   ISBN            STATUS    ERROR\n1     9780306406157   created\n2     0306406152      created\n",
+	}, {
+		name:    "csv with mapped columns",
+		file:    "books.csv",
+		content: "\ufeffCode,Name,Writer,Copies,Shelf\n978-0-306-40615-7,Dune,Frank Herbert,3,A1\n",
+		flags:   map[string]string{"columns": "isbn=Code,title=name,author=Writer,AvailableUnits=Copies"},
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SaveBook", testToken, "9780306406157", "Dune", "Frank Herbert", uint(3)).Return("success", nil)
+			return m
+		},
+		expectedOutput: "ROW   ISBN            STATUS    ERROR\n1     9780306406157   created\n",
+	}, {
+		name:          "csv without a mapped column",
+		file:          "books.csv",
+		content:       "Code,Name,Author\n978-0-306-40615-7,Dune,Frank Herbert\n",
+		flags:         map[string]string{"columns": "isbn=Code"},
+		expectedError: "Unable to read the books from books.csv: the csv has no column \"title\" for the title of the books, its columns are: Code, Name, Author",
+	}, {
+		name:    "json with failures",
+		file:    "books.json",
+		content: `[{"Isbn": "9780306406157", "Title": "Dune", "Author": "Frank Herbert", "AvailableUnits": 3}, {"isbn": "123", "title": "Emma", "author": "Jane Austen"}, {"Isbn": "0306406152", "Title": "Emma", "Author": "Jane Austen", "AvailableUnits": "two"}]`,
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SaveBook", testToken, "9780306406157", "Dune", "Frank Herbert", uint(3)).Return("", &client.APIError{StatusCode: 409, Message: "book already exists"})
+			return m
+		},
+		expectedOutput: "ROW   ISBN            STATUS    ERROR\n" +
+			"1     9780306406157   failed    Unable to save the book: book already exists (409 Conflict)\n" +
+			"2     123             invalid   invalid isbn \"123\": it must have 10 or 13 digits\n" +
+			"3                     invalid   not a book: field AvailableUnits: json: cannot unmarshal string into Go value of type uint\n",
+		expectedError:    "3 of 3 books were not imported, run it again with --resume to skip the books which were created",
+		expectedExitCode: exitCodeError,
+	}, {
+		name:    "ndjson which already exists",
+		file:    "books.ndjson",
+		content: "{\"Isbn\": \"9780306406157\", \"Title\": \"Dune\", \"Author\": \"Frank Herbert\"}\n{\"Isbn\": \"0306406152\", \"Title\": \"Emma\", \"Author\": \"Jane Austen\"}\n",
+		flags:   map[string]string{"fields": "row,status"},
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SaveBook", testToken, mock.Anything, mock.Anything, mock.Anything, uint(0)).Return("", &client.APIError{StatusCode: 409, Message: "book already exists"})
+			return m
+		},
+		expectedOutput:   "ROW   STATUS\n1     failed\n2     failed\n",
+		expectedError:    "2 of 2 books were not imported, run it again with --resume to skip the books which were created",
+		expectedExitCode: exitCodeConflict,
+	}, {
+		name:    "interrupted",
+		file:    "books.csv",
+		content: "isbn,title,author\n978-0-306-40615-7,Dune,Frank Herbert\n978-0-13-110362-7,The C Programming Language,Kernighan and Ritchie\n",
+		flags:   map[string]string{"workers": "1"},
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SaveBook", testToken, "9780306406157", "Dune", "Frank Herbert", uint(0)).Return("success", nil)
+			m.On("SaveBook", testToken, "9780131103627", mock.Anything, mock.Anything, uint(0)).Return("", context.Canceled)
+			return m
+		},
+		expectedOutput:   "ROW   ISBN            STATUS     ERROR\n1     9780306406157   created\n2     9780131103627   not-sent\n",
+		expectedError:    "1 of 2 books were not imported, run it again with --resume to skip the books which were created",
+		expectedExitCode: exitCodeError,
+	}, {
+		name:    "ndjson dry run",
+		file:    "books.ndjson",
+		content: "{\"Isbn\": \"9780306406157\", \"Title\": \"Dune\", \"Author\": \"Frank Herbert\"}\n\n{\"Isbn\": \"0306406152\", \"Title\": \"\", \"Author\": \"Jane Austen\"}\n",
+		flags:   map[string]string{"dry-run": "true", "output": "ndjson"},
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			return m
+		},
+		expectedOutput: `{"Row":1,"Isbn":"9780306406157","Status":"valid"}` + "\n" +
+			`{"Row":2,"Isbn":"0306406152","Status":"invalid","Error":"the title is empty"}` + "\n",
+		expectedError: "1 of 2 books are invalid",
+	}, {
+		name:    "without isbn validation",
+		file:    "books.ndjson",
+		content: `{"Isbn": " 123/4 ", "Title": "Dune", "Author": "Frank Herbert"}`,
+		flags:   map[string]string{"no-isbn-validation": "true", "workers": "1"},
+		mockBookClient: func(m *mockBookClient) *mockBookClient {
+			m.On("SaveBook", testToken, "123/4", "Dune", "Frank Herbert", uint(0)).Return("success", nil)
+			return m
+		},
+		expectedOutput: "ROW   ISBN    STATUS    ERROR\n1     123/4   created\n",
+	}, {
+		name:          "unknown extension",
+		file:          "books.txt",
+		content:       "isbn,title,author\n",
+		expectedError: "unable to tell the format of books.txt from its extension, set --format to one of csv, json, ndjson",
+	}, {
+		name:          "unknown column field",
+		file:          "books.csv",
+		content:       "isbn,title,author\n",
+		flags:         map[string]string{"columns": "publisher=Publisher"},
+		expectedError: `unknown field "publisher" in --columns, valid fields are: isbn, title, author, units`,
+	}, {
+		name:          "no workers",
+		file:          "books.csv",
+		content:       "isbn,title,author\n",
+		flags:         map[string]string{"workers": "0"},
+		expectedError: "--workers must be at least 1",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0600))
+
+			m := &mockBookClient{}
+			if tt.mockBookClient != nil {
+				tt.mockBookClient(m)
+			}
+			importCmd := NewImportCmd(m)
+			addImportFlags(importCmd)
+			addOutputFlags(importCmd.Flags())
+			for name, value := range tt.flags {
+				importCmd.Flags().Set(name, value)
+			}
+			importCmd.SetArgs([]string{filepath.Join(dir, tt.file)})
+			out, err := execute(importCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, strings.ReplaceAll(tt.expectedError, tt.file, filepath.Join(dir, tt.file)))
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.expectedExitCode != 0 {
+				assert.Equal(t, tt.expectedExitCode, exitCode(err))
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ImportCmd_Resume(t *testing.T) {
+	dir := t.TempDir()
+	books := filepath.Join(dir, "books.csv")
+	resume := filepath.Join(dir, "books.done")
+	assert.Nil(t, ioutil.WriteFile(books, []byte("isbn,title,author\n978-0-306-40615-7,Dune,Frank Herbert\n0-306-40615-2,Emma,Jane Austen\n"), 0600))
+	assert.Nil(t, ioutil.WriteFile(resume, []byte("9780306406157\n"), 0600))
+
+	m := &mockBookClient{}
+	m.On("SaveBook", testToken, "0306406152", "Emma", "Jane Austen", uint(0)).Return("success", nil).Once()
+	importCmd := NewImportCmd(m)
+	addImportFlags(importCmd)
+	addOutputFlags(importCmd.Flags())
+	importCmd.Flags().Set("resume", resume)
+	importCmd.SetArgs([]string{books})
+	out, err := execute(importCmd)
+	assert.Nil(t, err)
+	assert.Equal(t, "ROW   ISBN            STATUS    ERROR\n1     9780306406157   skipped\n2     0306406152      created\n", out)
+	m.AssertExpectations(t)
+
+	done, err := ioutil.ReadFile(resume)
+	assert.Nil(t, err)
+	assert.Equal(t, "9780306406157\n0306406152\n", string(done))
+}
+
+func Test_ImportCmd_Stdin(t *testing.T) {
+	m := &mockBookClient{}
+	m.On("SaveBook", testToken, "9780306406157", "Dune", "Frank Herbert", uint(1)).Return("", errors.New("connection reset"))
+	importCmd := NewImportCmd(m)
+	addImportFlags(importCmd)
+	addOutputFlags(importCmd.Flags())
+	importCmd.SetIn(strings.NewReader("isbn,title,author,units\n9780306406157,Dune,Frank Herbert,1\n"))
+	importCmd.SetArgs([]string{"-"})
+
+	_, err := execute(importCmd)
+	assert.EqualError(t, err, "set --format to one of csv, json, ndjson when reading from stdin")
+	assert.Equal(t, exitCodeUsage, exitCode(err))
+
+	importCmd.Flags().Set("format", "csv")
+	importCmd.Flags().Set("output", "csv")
+	out, err := execute(importCmd)
+	assert.Equal(t, "row,isbn,status,error\n1,9780306406157,failed,Unable to save the book. connection reset\n", out)
+	assert.EqualError(t, err, "1 of 1 books were not imported, run it again with --resume to skip the books which were created")
+	assert.Equal(t, exitCodeError, exitCode(err))
+}
+
+func Test_ImportCmd_StdinAndTokenStdin(t *testing.T) {
+	m := &mockBookClient{}
+	importCmd := NewImportCmd(m)
+	addImportFlags(importCmd)
+	addTokenFlags(importCmd)
+	importCmd.Flags().Set("format", "csv")
+	importCmd.Flags().Set("token-stdin", "true")
+	importCmd.SetIn(strings.NewReader(testToken + "\nisbn,title,author\n9780306406157,Dune,Frank Herbert\n"))
+	importCmd.SetArgs([]string{"-"})
+
+	_, err := execute(importCmd)
+	assert.EqualError(t, err, "import - and --token-stdin can not both read stdin, give the token with -t or --token-file")
+	assert.Equal(t, exitCodeUsage, exitCode(err))
+	m.AssertNotCalled(t, "SaveBook", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_Progress(t *testing.T) {
+	var b strings.Builder
+	p := &progress{w: &b}
+	p.start(4)
+	p.add(true)
+	p.add(false)
+	p.finish()
+	assert.Equal(t, "\r[                              ] 0/4, 0 created, 0 failed"+
+		"\r[=======                       ] 1/4, 1 created, 0 failed"+
+		"\r[===============               ] 2/4, 1 created, 1 failed\n", b.String())
+
+	var none *progress
+	none.start(4)
+	none.add(true)
+	none.finish()
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mishozz/library-cli/isbn"
+	"github.com/spf13/cobra"
+)
+
+// addISBNFlags adds the required -i and --no-isbn-validation to a command which works with one book
+func addISBNFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("isbn", "i", "", "Isbn of the book, an ISBN-10 or ISBN-13 with or without hyphens")
+	cmd.Flags().Bool("no-isbn-validation", false, "Send the isbn as it is given instead of checking it and removing hyphens")
+	cmd.MarkFlagRequired("isbn")
+}
+
+// isbnFlag returns the isbn given with -i without hyphens and spaces.
+// Isbns with a wrong check digit are refused unless --no-isbn-validation is set.
+func isbnFlag(cmd *cobra.Command) (string, error) {
+	value, _ := cmd.Flags().GetString("isbn")
+	if skip, _ := cmd.Flags().GetBool("no-isbn-validation"); skip {
+		return strings.TrimSpace(value), nil
+	}
+	parsed, err := isbn.Parse(value)
+	if err != nil {
+		return "", usageError(fmt.Errorf("%v (use --no-isbn-validation to send it as it is)", err))
+	}
+	return parsed.String(), nil
+}
+
+// addISBNListFlags adds the required -i and --no-isbn-validation to a command which works with several books.
+// -i can be repeated, hold a comma separated list or be - to read the isbns from stdin.
+func addISBNListFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("isbn", "i", nil, "Isbns of the books, repeated or comma separated, or - to read them from stdin")
+	cmd.Flags().Bool("no-isbn-validation", false, "Send the isbns as they are given instead of checking them and removing hyphens")
+	cmd.MarkFlagRequired("isbn")
+}
+
+// isbnListFlag returns the isbns given with -i like isbnFlag, without the ones given twice.
+// The ISBN-10 and ISBN-13 of a book are the same book, the first one given is sent.
+// With -i - the isbns are read from stdin, one per line or separated by commas.
+func isbnListFlag(cmd *cobra.Command) ([]string, error) {
+	values, _ := cmd.Flags().GetStringSlice("isbn")
+	skip, _ := cmd.Flags().GetBool("no-isbn-validation")
+
+	var given []string
+	for _, value := range values {
+		if strings.TrimSpace(value) != "-" {
+			given = append(given, value)
+			continue
+		}
+		if err := stdinFree(cmd, "-i -"); err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the isbns from stdin: %w", err)
+		}
+		given = append(given, strings.FieldsFunc(string(data), func(r rune) bool { return r == ',' || r == '\n' })...)
+	}
+
+	var isbns []string
+	seen := map[string]bool{}
+	for _, value := range given {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		key := value
+		if !skip {
+			parsed, err := isbn.Parse(value)
+			if err != nil {
+				return nil, usageError(fmt.Errorf("%v (use --no-isbn-validation to send it as it is)", err))
+			}
+			value, key = parsed.String(), parsed.To13().String()
+		}
+		if !seen[key] {
+			seen[key] = true
+			isbns = append(isbns, value)
+		}
+	}
+	if len(isbns) == 0 {
+		return nil, usageError(errors.New("no isbns were given"))
+	}
+	return isbns, nil
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ISBNFlag(t *testing.T) {
+	tests := []struct {
+		name         string
+		isbn         string
+		noValidation bool
+		expected     string
+		err          string
+	}{
+		{name: "hyphens", isbn: "0-306-40615-2", expected: "0306406152"},
+		{name: "isbn 13", isbn: "978 0 306 40615 7", expected: "9780306406157"},
+		{name: "wrong check digit", isbn: "0-306-40615-3", err: `invalid isbn "0-306-40615-3": the check digit should be 2 (use --no-isbn-validation to send it as it is)`},
+		{name: "without validation", isbn: " 123/4 ", noValidation: true, expected: "123/4"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addISBNFlags(cmd)
+			cmd.Flags().Set("isbn", tt.isbn)
+			if tt.noValidation {
+				cmd.Flags().Set("no-isbn-validation", "true")
+			}
+
+			isbn, err := isbnFlag(cmd)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.Equal(t, exitCodeUsage, exitCode(err))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, isbn)
+		})
+	}
+}
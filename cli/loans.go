@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// defaultLoanWorkers is how many books take and return send at the same time unless --workers is set
+const defaultLoanWorkers = 4
+
+// rollbackTimeout limits every undo of --all-or-nothing, which does not stop when the command is interrupted
+const rollbackTimeout = 10 * time.Second
+
+// Statuses of the books in the report of take and return
+const (
+	loanDone    = "done"
+	loanFailed  = "failed"
+	loanNotSent = "not-sent"
+	// loanRolledBack books were taken or returned and undone again because of --all-or-nothing
+	loanRolledBack = "rolled-back"
+)
+
+// loanResult is the outcome of taking or returning a book
+type loanResult struct {
+	Isbn   string `json:"Isbn"`
+	Status string `json:"Status"`
+	Error  string `json:"Error,omitempty"`
+	// err is the error of the request which failed
+	err error
+}
+
+var loanColumns = []column{
+	{name: "isbn", header: "ISBN", key: "Isbn", text: func(item interface{}) string { return item.(loanResult).Isbn }},
+	{name: "status", header: "STATUS", key: "Status", text: func(item interface{}) string { return item.(loanResult).Status }},
+	{name: "error", header: "ERROR", key: "Error", text: func(item interface{}) string { return item.(loanResult).Error }},
+}
+
+// loanAction is taking or returning a book, undo is the opposite action used by --all-or-nothing
+type loanAction struct {
+	// verb is the past tense used in the errors, "taken" or "returned"
+	verb   string
+	action string
+	do     func(ctx context.Context, token, email, isbn string) error
+	undo   func(ctx context.Context, token, email, isbn string) error
+	// undoAction is the action of undo in the errors
+	undoAction string
+	// keyed actions are sent with the --idempotency-key of the command
+	keyed bool
+}
+
+func takeAction(userClient client.UserClient) loanAction {
+	return loanAction{
+		verb:   "taken",
+		action: "Unable to take book from the library",
+		do: func(ctx context.Context, token, email, isbn string) error {
+			_, err := userClient.TakeBook(ctx, token, email, isbn)
+			return err
+		},
+		undo:       userClient.ReturnBook,
+		undoAction: "Unable to return it again",
+		keyed:      true,
+	}
+}
+
+func returnAction(userClient client.UserClient) loanAction {
+	return loanAction{
+		verb:   "returned",
+		action: "Unable to return your book",
+		do:     userClient.ReturnBook,
+		undo: func(ctx context.Context, token, email, isbn string) error {
+			_, err := userClient.TakeBook(ctx, token, email, isbn)
+			return err
+		},
+		undoAction: "Unable to take it again",
+	}
+}
+
+// addLoanFlags adds the flags of take and return which work with several books
+func addLoanFlags(cmd *cobra.Command) {
+	addISBNListFlags(cmd)
+	cmd.Flags().Int("workers", defaultLoanWorkers, "How many books are sent at the same time when several isbns are given")
+	cmd.Flags().Bool("all-or-nothing", false, "Undo the books which were done when one of them fails")
+}
+
+// loans takes or returns the books of a user with a pool of workers
+type loans struct {
+	loanAction
+	token          string
+	email          string
+	workers        int
+	allOrNothing   bool
+	idempotencyKey string
+}
+
+func newLoans(cmd *cobra.Command, action loanAction, token, email string) (*loans, error) {
+	l := &loans{loanAction: action, token: token, email: email}
+	l.workers, _ = cmd.Flags().GetInt("workers")
+	l.allOrNothing, _ = cmd.Flags().GetBool("all-or-nothing")
+	if action.keyed {
+		l.idempotencyKey, _ = cmd.Flags().GetString("idempotency-key")
+	}
+	if l.workers < 1 {
+		return nil, usageError(errors.New("--workers must be at least 1"))
+	}
+	return l, nil
+}
+
+// run sends the books by --workers requests at the same time.
+// With --all-or-nothing no more books are sent after the first failure and the done ones are undone.
+func (l *loans) run(cmd *cobra.Command, isbns []string) []loanResult {
+	results := make([]loanResult, len(isbns))
+	for i, isbn := range isbns {
+		results[i] = loanResult{Isbn: isbn, Status: loanNotSent}
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < l.workers && w < len(isbns); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = l.send(cmd, results[i])
+				if results[i].Status == loanFailed && l.allOrNothing {
+					stop()
+				}
+			}
+		}()
+	}
+feed:
+	for i := range isbns {
+		// a canceled context wins over a waiting worker
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if l.allOrNothing && !allDone(results) {
+		for i := range results {
+			if results[i].Status == loanDone {
+				results[i] = l.rollback(results[i])
+			}
+		}
+	}
+	return results
+}
+
+// send takes or returns one book, each book gets its own idempotency key derived from --idempotency-key
+func (l *loans) send(cmd *cobra.Command, result loanResult) loanResult {
+	ctx, cancel := requestContext(cmd)
+	defer cancel()
+	if l.idempotencyKey != "" {
+		ctx = client.WithIdempotencyKey(ctx, l.idempotencyKey+"-"+result.Isbn)
+	}
+	if err := l.do(ctx, l.token, l.email, result.Isbn); err != nil {
+		result.Status, result.err = loanFailed, failure(err, l.action, err.Error())
+		result.Error = result.err.Error()
+		return result
+	}
+	result.Status = loanDone
+	return result
+}
+
+// rollback undoes a book which was done, it stays done when that fails.
+// It does not use the context of the command, so the books are undone also after Ctrl-C.
+func (l *loans) rollback(result loanResult) loanResult {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	if err := l.undo(ctx, l.token, l.email, result.Isbn); err != nil {
+		result.err = failure(err, l.undoAction, err.Error())
+		result.Error = result.err.Error()
+		return result
+	}
+	result.Status = loanRolledBack
+	return result
+}
+
+func allDone(results []loanResult) bool {
+	for _, result := range results {
+		if result.Status != loanDone {
+			return false
+		}
+	}
+	return true
+}
+
+// loansError returns an error when some of the books were not taken or returned,
+// with the exit code of the failed requests when they all share it
+func loansError(results []loanResult, l *loans) error {
+	counts := map[string]int{}
+	var stuck []string
+	var failures []error
+	for _, result := range results {
+		counts[result.Status]++
+		if result.Status == loanDone && result.err != nil {
+			stuck = append(stuck, result.Isbn)
+		}
+		if result.err != nil {
+			failures = append(failures, result.err)
+		}
+	}
+	switch {
+	case counts[loanDone] == len(results):
+		return nil
+	case len(stuck) > 0:
+		return batchError(fmt.Sprintf("%d of %d books could not be %s and %d could not be undone: %s",
+			counts[loanFailed], len(results), l.verb, len(stuck), strings.Join(stuck, ", ")), failures)
+	case l.allOrNothing:
+		return batchError(fmt.Sprintf("%d of %d books could not be %s, nothing was changed because of --all-or-nothing",
+			counts[loanFailed], len(results), l.verb), failures)
+	}
+	return batchError(fmt.Sprintf("%d of %d books were not %s", len(results)-counts[loanDone], len(results), l.verb), failures)
+}
+
+// runLoans takes or returns several books and prints a report of every book
+func runLoans(cmd *cobra.Command, action loanAction, token, email string, isbns []string) error {
+	p, err := newPrinter(cmd)
+	if err != nil {
+		return err
+	}
+	l, err := newLoans(cmd, action, token, email)
+	if err != nil {
+		return err
+	}
+	results := l.run(cmd, isbns)
+	items := make([]interface{}, len(results))
+	for i, result := range results {
+		items[i] = result
+	}
+	if err := p.print(cmd.OutOrStdout(), loanColumns, items, false); err != nil {
+		return err
+	}
+	return loansError(results, l)
+}
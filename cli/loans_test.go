@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	duneISBN  = "9780306406157"
+	emmaISBN  = "0141439580"
+	kandrISBN = "9780131103627"
+)
+
+var bookNotFound = &client.APIError{StatusCode: 404, Message: "book not found"}
+
+// loanCmd returns take or return with their flags
+func loanCmd(newCmd func(client.UserClient) *cobra.Command, m *mockUserClient, flags map[string]string) *cobra.Command {
+	cmd := newCmd(m)
+	addEmailFlag(cmd)
+	addLoanFlags(cmd)
+	addOutputFlags(cmd.Flags())
+	cmd.Flags().Set("email", testEmail)
+	for name, value := range flags {
+		cmd.Flags().Set(name, value)
+	}
+	return cmd
+}
+
+func Test_TakeBooks(t *testing.T) {
+	email := "Misho+Books@gmail.com"
+	tests := []struct {
+		name           string
+		isbns          []string
+		stdin          string
+		flags          map[string]string
+		mockUserClient func(m *mockUserClient)
+		expectedOutput string
+		expectedError  string
+		// expectedExitCode is only checked when it is set
+		expectedExitCode int
+	}{{
+		name:  "repeated and comma separated",
+		isbns: []string{"978-0-306-40615-7,0-14-143958-0", "9780131103627", "9780306406157", "0-306-40615-2"},
+		mockUserClient: func(m *mockUserClient) {
+			m.On("TakeBook", testToken, email, duneISBN).Return("success", nil).Once()
+			m.On("TakeBook", testToken, email, emmaISBN).Return("success", nil).Once()
+			m.On("TakeBook", testToken, email, kandrISBN).Return("success", nil).Once()
+		},
+		expectedOutput: "ISBN            STATUS   ERROR\n" +
+			"9780306406157   done\n" +
+			"0141439580      done\n" +
+			"9780131103627   done\n",
+	}, {
+		name:  "from stdin",
+		isbns: []string{"-"},
+		stdin: "978-0-306-40615-7\n\n0-14-143958-0, 9780131103627\n",
+		flags: map[string]string{"output": "ndjson", "workers": "1"},
+		mockUserClient: func(m *mockUserClient) {
+			m.On("TakeBook", testToken, email, duneISBN).Return("success", nil)
+			m.On("TakeBook", testToken, email, emmaISBN).Return("", bookNotFound)
+			m.On("TakeBook", testToken, email, kandrISBN).Return("success", nil)
+		},
+		expectedOutput: `{"Isbn":"9780306406157","Status":"done"}` + "\n" +
+			`{"Isbn":"0141439580","Status":"failed","Error":"Unable to take book from the library: book not found (404 Not Found)"}` + "\n" +
+			`{"Isbn":"9780131103627","Status":"done"}` + "\n",
+		expectedError:    "1 of 3 books were not taken",
+		expectedExitCode: exitCodeNotFound,
+	}, {
+		name:  "all or nothing",
+		isbns: []string{duneISBN, emmaISBN, kandrISBN},
+		flags: map[string]string{"all-or-nothing": "true", "workers": "1"},
+		mockUserClient: func(m *mockUserClient) {
+			m.On("TakeBook", testToken, email, duneISBN).Return("success", nil)
+			m.On("TakeBook", testToken, email, emmaISBN).Return("", bookNotFound)
+			m.On("ReturnBook", testToken, email, duneISBN).Return(nil)
+		},
+		expectedOutput: "ISBN            STATUS        ERROR\n" +
+			"9780306406157   rolled-back\n" +
+			"0141439580      failed        Unable to take book from the library: book not found (404 Not Found)\n" +
+			"9780131103627   not-sent\n",
+		expectedError:    "1 of 3 books could not be taken, nothing was changed because of --all-or-nothing",
+		expectedExitCode: exitCodeNotFound,
+	}, {
+		name:  "all or nothing which can not be undone",
+		isbns: []string{duneISBN, emmaISBN},
+		flags: map[string]string{"all-or-nothing": "true", "workers": "1", "fields": "isbn,status"},
+		mockUserClient: func(m *mockUserClient) {
+			m.On("TakeBook", testToken, email, duneISBN).Return("success", nil)
+			m.On("TakeBook", testToken, email, emmaISBN).Return("", bookNotFound)
+			m.On("ReturnBook", testToken, email, duneISBN).Return(&client.APIError{StatusCode: 503, Message: "maintenance"})
+		},
+		expectedOutput: "ISBN            STATUS\n" +
+			"9780306406157   done\n" +
+			"0141439580      failed\n",
+		expectedError:    "1 of 2 books could not be taken and 1 could not be undone: 9780306406157",
+		expectedExitCode: exitCodeError,
+	}, {
+		name:  "unauthorized",
+		isbns: []string{duneISBN, emmaISBN},
+		flags: map[string]string{"fields": "isbn,status"},
+		mockUserClient: func(m *mockUserClient) {
+			m.On("TakeBook", testToken, email, mock.Anything).Return("", &client.APIError{StatusCode: 401, Message: "invalid token"})
+		},
+		expectedOutput:   "ISBN            STATUS\n9780306406157   failed\n0141439580      failed\n",
+		expectedError:    "2 of 2 books were not taken",
+		expectedExitCode: exitCodeAuth,
+	}, {
+		name:          "invalid isbn",
+		isbns:         []string{duneISBN, "9780306406158"},
+		expectedError: "invalid isbn \"9780306406158\": the check digit should be 7 (use --no-isbn-validation to send it as it is)",
+	}, {
+		name:          "empty stdin",
+		isbns:         []string{"-"},
+		stdin:         "\n",
+		expectedError: "no isbns were given",
+	}, {
+		name:          "no workers",
+		isbns:         []string{duneISBN, emmaISBN},
+		flags:         map[string]string{"workers": "0"},
+		expectedError: "--workers must be at least 1",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockUserClient{}
+			if tt.mockUserClient != nil {
+				tt.mockUserClient(m)
+			}
+			takeCmd := loanCmd(NewTakeBookCmd, m, tt.flags)
+			for _, isbn := range tt.isbns {
+				takeCmd.Flags().Set("isbn", isbn)
+			}
+			takeCmd.SetIn(strings.NewReader(tt.stdin))
+
+			out, err := execute(takeCmd)
+			assertError(t, tt.expectedError, err)
+			assert.Equal(t, tt.expectedOutput, out)
+			if tt.expectedExitCode != 0 {
+				assert.Equal(t, tt.expectedExitCode, exitCode(err))
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ReturnBooks(t *testing.T) {
+	email := "Misho+Books@gmail.com"
+	m := &mockUserClient{}
+	m.On("ReturnBook", testToken, email, duneISBN).Return(nil)
+	m.On("ReturnBook", testToken, email, emmaISBN).Return(bookNotFound)
+	m.On("TakeBook", testToken, email, duneISBN).Return("success", nil)
+	returnCmd := loanCmd(NewReturnBookCmd, m, map[string]string{"all-or-nothing": "true", "workers": "1", "output": "ndjson"})
+	returnCmd.Flags().Set("isbn", duneISBN+","+emmaISBN)
+
+	out, err := execute(returnCmd)
+	assertError(t, "1 of 2 books could not be returned, nothing was changed because of --all-or-nothing", err)
+	assert.Equal(t, `{"Isbn":"9780306406157","Status":"rolled-back"}`+"\n"+
+		`{"Isbn":"0141439580","Status":"failed","Error":"Unable to return your book: book not found (404 Not Found)"}`+"\n", out)
+	m.AssertExpectations(t)
+}
+
+func Test_TakeBooks_TokenStdin(t *testing.T) {
+	m := &mockUserClient{}
+	takeCmd := loanCmd(NewTakeBookCmd, m, nil)
+	addTokenFlags(takeCmd)
+	takeCmd.Flags().Set("token-stdin", "true")
+	takeCmd.Flags().Set("isbn", "-")
+	takeCmd.SetIn(strings.NewReader(testToken + "\n" + testISBN + "\n" + emmaISBN + "\n"))
+
+	_, err := execute(takeCmd)
+	assertError(t, "-i - and --token-stdin can not both read stdin, give the token with -t or --token-file", err)
+	assert.Equal(t, exitCodeUsage, exitCode(err))
+	m.AssertNotCalled(t, "TakeBook", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_Loans_RollbackAfterInterrupt(t *testing.T) {
+	ctx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	var undoErr error
+	action := loanAction{
+		verb:   "taken",
+		action: "Unable to take book from the library",
+		do: func(ctx context.Context, token, email, isbn string) error {
+			if isbn == emmaISBN {
+				interrupt()
+				return ctx.Err()
+			}
+			return nil
+		},
+		undo: func(ctx context.Context, token, email, isbn string) error {
+			undoErr = ctx.Err()
+			return undoErr
+		},
+		undoAction: "Unable to return it again",
+	}
+	var results []loanResult
+	cmd := &cobra.Command{Run: func(cmd *cobra.Command, args []string) {
+		l := &loans{loanAction: action, workers: 1, allOrNothing: true}
+		results = l.run(cmd, []string{duneISBN, emmaISBN})
+	}}
+	assert.Nil(t, cmd.ExecuteContext(ctx))
+
+	assert.Nil(t, undoErr, "the rollback does not use the interrupted context")
+	assert.Equal(t, loanRolledBack, results[0].Status)
+	assert.Equal(t, loanFailed, results[1].Status)
+}
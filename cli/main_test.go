@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishozz/library-cli/config"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testToken = "testToken"
+	// testISBN is a valid isbn with hyphens, the commands send it as 9780306406157
+	testISBN = "978-0-306-40615-7"
+	// testEmail is a valid email which the commands send as Misho+Books@gmail.com
+	testEmail = " Misho+Books@Gmail.com "
+)
+
+// TestMain points the commands at a temporary config directory with a stored session,
+// so the tests never touch the real config and credentials files
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "library-cli")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv(config.EnvConfig, filepath.Join(dir, "config.json"))
+	os.Unsetenv(config.EnvProfile)
+	if err := storeTestSession(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func storeTestSession() error {
+	return saveSession(&config.Session{Email: "misho@gmail.com", Token: testToken})
+}
+
+// execute runs the command and returns what it wrote to stdout,
+// errors are returned instead of being printed like in Execute
+func execute(cmd *cobra.Command) (string, error) {
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	err := cmd.Execute()
+	return b.String(), err
+}
+
+// assertError checks the message of err, an empty expected message means no error
+func assertError(t *testing.T, expected string, err error) {
+	t.Helper()
+	if expected == "" {
+		assert.Nil(t, err)
+		return
+	}
+	assert.EqualError(t, err, expected)
+}
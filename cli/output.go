@@ -0,0 +1,418 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Output formats accepted by -o
+const (
+	outputTable  = "table"
+	outputWide   = "wide"
+	outputJSON   = "json"
+	outputYAML   = "yaml"
+	outputCSV    = "csv"
+	outputNDJSON = "ndjson"
+)
+
+var outputFormats = []string{outputTable, outputWide, outputJSON, outputYAML, outputCSV, outputNDJSON}
+
+// addOutputFlags adds the flags which select how the listing and get commands print their result
+func addOutputFlags(flags *pflag.FlagSet) {
+	flags.StringP("output", "o", "", "Output format: "+strings.Join(outputFormats, ", ")+
+		", go-template=TEMPLATE, go-template-file=PATH or jsonpath=TEMPLATE (default table or the output of the profile)")
+	flags.StringSlice("fields", nil, "Comma separated fields to print, e.g. isbn,title")
+	flags.Bool("no-headers", false, "Do not print the column headers of table, wide and csv output")
+}
+
+// column is a field of the printed items
+type column struct {
+	// name is used by --fields
+	name string
+	// header is printed above the column in table, wide and csv output
+	header string
+	// key is the key of the field in the json of the item, the name is used when it is empty
+	key string
+	// wide columns are only printed by -o wide and csv
+	wide bool
+	// text returns the value printed in table, wide and csv output
+	text func(item interface{}) string
+}
+
+var bookColumns = []column{
+	{name: "isbn", header: "ISBN", key: "Isbn", text: func(item interface{}) string { return item.(client.BookDetails).Isbn }},
+	{name: "title", header: "TITLE", key: "Title", text: func(item interface{}) string { return item.(client.BookDetails).Title }},
+	{name: "author", header: "AUTHOR", key: "Author", text: func(item interface{}) string { return item.(client.BookDetails).Author }},
+	{name: "units", header: "UNITS", key: "AvailableUnits", text: func(item interface{}) string {
+		return strconv.FormatUint(uint64(item.(client.BookDetails).AvailableUnits), 10)
+	}},
+}
+
+var userColumns = []column{
+	{name: "email", header: "EMAIL", key: "Email", text: func(item interface{}) string { return item.(client.User).Email }},
+	{name: "role", header: "ROLE", key: "Role", text: func(item interface{}) string { return item.(client.User).Role }},
+	{name: "books", header: "BOOKS", key: "TakenBooks", text: func(item interface{}) string {
+		return strconv.Itoa(len(item.(client.User).TakenBooks))
+	}},
+	{name: "isbns", header: "ISBNS", wide: true, text: func(item interface{}) string {
+		var isbns []string
+		for _, book := range item.(client.User).TakenBooks {
+			isbns = append(isbns, book.Isbn)
+		}
+		return strings.Join(isbns, ",")
+	}},
+}
+
+func bookItems(books []client.BookDetails) []interface{} {
+	items := make([]interface{}, len(books))
+	for i, book := range books {
+		items[i] = book
+	}
+	return items
+}
+
+func userItems(users []client.User) []interface{} {
+	items := make([]interface{}, len(users))
+	for i, user := range users {
+		items[i] = user
+	}
+	return items
+}
+
+// extraColumns returns a wide column for every field the library REST API returned which the cli does not know
+func extraColumns(items []interface{}) []column {
+	seen := map[string]bool{}
+	for _, item := range items {
+		for key := range extraOf(item) {
+			seen[key] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	columns := make([]column, 0, len(keys))
+	for _, key := range keys {
+		key := key
+		columns = append(columns, column{name: key, header: strings.ToUpper(key), key: key, wide: true, text: func(item interface{}) string {
+			return rawText(extraOf(item)[key])
+		}})
+	}
+	return columns
+}
+
+func extraOf(item interface{}) map[string]json.RawMessage {
+	switch v := item.(type) {
+	case client.BookDetails:
+		return v.Extra
+	case client.User:
+		return v.Extra
+	}
+	return nil
+}
+
+// rawText returns a json string without quotes and other json values as they are
+func rawText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// printer writes items in the output format selected by the flags of the command
+type printer struct {
+	format    string
+	fields    []string
+	noHeaders bool
+	// template is set for the go-template, go-template-file and jsonpath formats
+	template executor
+}
+
+// newPrinter reads -o, --fields and --no-headers. The output of the profile is used when -o is not set.
+func newPrinter(cmd *cobra.Command) (*printer, error) {
+	p := &printer{}
+	p.format, _ = cmd.Flags().GetString("output")
+	p.fields, _ = cmd.Flags().GetStringSlice("fields")
+	p.noHeaders, _ = cmd.Flags().GetBool("no-headers")
+	if p.format == "" {
+		p.format = current.profile.Output
+	}
+	if p.format == "" {
+		p.format = outputTable
+	}
+
+	for _, format := range outputFormats {
+		if p.format == format {
+			return p, nil
+		}
+	}
+	template, err := parseTemplate(p.format)
+	if err != nil {
+		return nil, usageError(err)
+	}
+	if template == nil {
+		return nil, usageError(fmt.Errorf("unknown output format %q, valid formats are: %s, %s..., %s... and %s...",
+			p.format, strings.Join(outputFormats, ", "), outputGoTemplate, outputGoTemplateFile, outputJSONPath))
+	}
+	p.template = template
+	return p, nil
+}
+
+// print writes the items, single is set when the command returns one item instead of a list
+func (p *printer) print(w io.Writer, columns []column, items []interface{}, single bool) error {
+	if p.template != nil {
+		var value interface{} = items
+		if single && len(items) == 1 {
+			value = items[0]
+		}
+		data, err := templateData(value)
+		if err != nil {
+			return err
+		}
+		return p.template.Execute(w, data)
+	}
+
+	columns = append(append([]column{}, columns...), extraColumns(items)...)
+	selected, err := p.columns(columns)
+	if err != nil {
+		return err
+	}
+
+	switch p.format {
+	case outputJSON, outputYAML, outputNDJSON:
+		return p.printStructured(w, selected, items, single)
+	case outputCSV:
+		return p.printCSV(w, selected, items)
+	}
+	return p.printTable(w, selected, items)
+}
+
+// columns returns the columns chosen by --fields, or nil for json, yaml and ndjson which print the whole items
+func (p *printer) columns(columns []column) ([]column, error) {
+	if len(p.fields) == 0 {
+		switch p.format {
+		case outputJSON, outputYAML, outputNDJSON:
+			return nil, nil
+		case outputTable:
+			var selected []column
+			for _, c := range columns {
+				if !c.wide {
+					selected = append(selected, c)
+				}
+			}
+			return selected, nil
+		}
+		return columns, nil
+	}
+
+	var selected []column
+	for _, field := range p.fields {
+		c, ok := findColumn(columns, field)
+		if !ok {
+			names := make([]string, len(columns))
+			for i, c := range columns {
+				names[i] = c.name
+			}
+			return nil, usageError(fmt.Errorf("unknown field %q, valid fields are: %s", field, strings.Join(names, ", ")))
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// findColumn matches the name or json key of the column in any case, e.g. "units", "AvailableUnits" or "available_units"
+func findColumn(columns []column, field string) (column, bool) {
+	field = fieldKey(field)
+	for _, c := range columns {
+		if fieldKey(c.name) == field || (c.key != "" && fieldKey(c.key) == field) {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+func fieldKey(s string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+func (p *printer) printTable(w io.Writer, columns []column, items []interface{}) error {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+	if !p.noHeaders {
+		headers := make([]string, len(columns))
+		for i, c := range columns {
+			headers[i] = c.header
+		}
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	}
+	for _, item := range items {
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			// tabs and line breaks would break the columns
+			cells[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(c.text(item))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// empty cells at the end of a row leave padding behind
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\n") {
+			lines[i] = strings.TrimRight(line, " \n") + "\n"
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, ""))
+	return err
+}
+
+func (p *printer) printCSV(w io.Writer, columns []column, items []interface{}) error {
+	cw := csv.NewWriter(w)
+	if !p.noHeaders {
+		headers := make([]string, len(columns))
+		for i, c := range columns {
+			headers[i] = c.name
+		}
+		cw.Write(headers)
+	}
+	for _, item := range items {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = c.text(item)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (p *printer) printStructured(w io.Writer, columns []column, items []interface{}, single bool) error {
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		values[i] = item
+		if columns != nil {
+			r, err := newRecord(item, columns)
+			if err != nil {
+				return err
+			}
+			values[i] = r
+		}
+	}
+
+	if p.format == outputNDJSON {
+		for _, value := range values {
+			data, err := marshalJSON(value, false)
+			if err != nil {
+				return err
+			}
+			w.Write(data)
+		}
+		return nil
+	}
+
+	var value interface{} = values
+	if single && len(values) == 1 {
+		value = values[0]
+	}
+	data, err := marshalJSON(value, true)
+	if err != nil {
+		return err
+	}
+	if p.format == outputYAML {
+		if data, err = yaml.FromJSON(data); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// marshalJSON encodes the value without escaping html characters and ends it with a line break
+func marshalJSON(value interface{}, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// record is an item reduced to the columns chosen by --fields, it keeps their order in json
+type record struct {
+	keys   []string
+	values []json.RawMessage
+}
+
+func newRecord(item interface{}, columns []column) (*record, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	r := &record{}
+	for _, c := range columns {
+		key, value := c.key, fields[c.key]
+		switch {
+		case key == "":
+			// the column is computed by the cli
+			key = c.name
+			if value, err = json.Marshal(c.text(item)); err != nil {
+				return nil, err
+			}
+		case value == nil:
+			// an extra field which only some of the items have
+			value = json.RawMessage("null")
+		}
+		r.keys = append(r.keys, key)
+		r.values = append(r.values, value)
+	}
+	return r, nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (r *record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(r.values[i])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/spf13/cobra"
+)
+
+// addBookQueryFlags adds the flags which filter, sort and page the books of get-all
+func addBookQueryFlags(cmd *cobra.Command) {
+	cmd.Flags().String("author", "", "Only books whose author contains this text")
+	cmd.Flags().String("title", "", "Only books whose title contains this text")
+	cmd.Flags().Bool("available", false, "Only books with available units")
+	cmd.Flags().Bool("out-of-stock", false, "Only books without available units")
+	cmd.Flags().String("sort-by", "", "Sort the books by "+strings.Join(client.BookSortKeys, ", "))
+	cmd.Flags().Bool("reverse", false, "Reverse the order of the books")
+	cmd.Flags().Int("limit", 0, "Print at most this many books, 0 means all")
+	cmd.Flags().Int("offset", 0, "Skip this many books")
+}
+
+// bookQuery reads the flags added by addBookQueryFlags
+func bookQuery(cmd *cobra.Command) (client.BookQuery, error) {
+	var q client.BookQuery
+	q.Author, _ = cmd.Flags().GetString("author")
+	q.Title, _ = cmd.Flags().GetString("title")
+	q.SortBy, _ = cmd.Flags().GetString("sort-by")
+	q.Reverse, _ = cmd.Flags().GetBool("reverse")
+	q.Limit, _ = cmd.Flags().GetInt("limit")
+	q.Offset, _ = cmd.Flags().GetInt("offset")
+
+	available, _ := cmd.Flags().GetBool("available")
+	outOfStock, _ := cmd.Flags().GetBool("out-of-stock")
+	switch {
+	case available && outOfStock:
+		return q, usageError(errors.New("--available and --out-of-stock can not be used together"))
+	case available:
+		q.Available = &available
+	case outOfStock:
+		q.Available = new(bool)
+	}
+
+	if q.SortBy != "" {
+		valid := false
+		for _, key := range client.BookSortKeys {
+			valid = valid || q.SortBy == key
+		}
+		if !valid {
+			return q, usageError(fmt.Errorf("invalid --sort-by %q, valid values are: %s", q.SortBy, strings.Join(client.BookSortKeys, ", ")))
+		}
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return q, usageError(errors.New("--limit and --offset can not be negative"))
+	}
+	return q, nil
+}
+
+// addUserQueryFlags adds the flags which filter the users of get-all-users
+func addUserQueryFlags(cmd *cobra.Command) {
+	cmd.Flags().String("email-contains", "", "Only users whose email contains this text")
+	cmd.Flags().Bool("has-loans", false, "Only users who have taken books, --has-loans=false for the ones who have not")
+}
+
+// userQuery reads the flags added by addUserQueryFlags
+func userQuery(cmd *cobra.Command) client.UserQuery {
+	var q client.UserQuery
+	q.EmailContains, _ = cmd.Flags().GetString("email-contains")
+	if cmd.Flags().Changed("has-loans") {
+		hasLoans, _ := cmd.Flags().GetBool("has-loans")
+		q.HasLoans = &hasLoans
+	}
+	return q
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mishozz/library-cli/jwt"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// roleAnnotation is the annotation of commands which require a role
+	roleAnnotation = "role"
+	adminRole      = "Admin"
+)
+
+var ignoreRoleCheck bool
+
+// requiredRole returns the role the command requires or "" when any user can run it
+func requiredRole(cmd *cobra.Command) string {
+	return cmd.Annotations[roleAnnotation]
+}
+
+// requiresAdmin is used by the usage template to split the commands into sections
+func requiresAdmin(cmd *cobra.Command) bool {
+	return requiredRole(cmd) == adminRole
+}
+
+// checkRole refuses to run a command which requires a role the token does not have.
+// Tokens which can not be decoded are left for the library REST API to judge.
+func checkRole(cmd *cobra.Command) error {
+	role := requiredRole(cmd)
+	if role == "" || ignoreRoleCheck {
+		return nil
+	}
+	token, err := resolveToken(cmd)
+	if err != nil {
+		return nil
+	}
+	claims, err := jwt.Parse(token)
+	if err != nil || strings.EqualFold(claims.UserRole, role) {
+		return nil
+	}
+	return &exitError{
+		code: exitCodeForbidden,
+		err: fmt.Errorf("%s requires %s role, your token has role %q (use --ignore-role-check to skip this check)",
+			cmd.CommandPath(), role, claims.UserRole),
+	}
+}
+
+// sessionRole returns the role of the stored session or "" when it is unknown
+func sessionRole() string {
+	session, err := loadSession()
+	if err != nil || session == nil {
+		return ""
+	}
+	claims, err := jwt.Parse(session.Token)
+	if err != nil {
+		return ""
+	}
+	return claims.UserRole
+}
+
+// adminSectionNote explains why the admin commands are not available to the logged in user
+func adminSectionNote() string {
+	role := sessionRole()
+	if role == "" || strings.EqualFold(role, adminRole) {
+		return ""
+	}
+	return fmt.Sprintf(" (not available, you are logged in with role %s)", role)
+}
+
+func hasAdminCommands(cmd *cobra.Command) bool {
+	for _, c := range cmd.Commands() {
+		if c.IsAvailableCommand() && requiresAdmin(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// usageTemplate is the default cobra usage template with the commands
+// split into user and admin sections
+const usageTemplate = `Usage:{{if .Runnable}}
+  {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
+  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+
+Aliases:
+  {{.NameAndAliases}}{{end}}{{if .HasExample}}
+
+Examples:
+{{.Example}}{{end}}{{if .HasAvailableSubCommands}}
+
+{{if hasAdminCommands .}}User Commands:{{else}}Available Commands:{{end}}{{range .Commands}}{{if and (or .IsAvailableCommand (eq .Name "help")) (not (requiresAdmin .))}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{if hasAdminCommands .}}
+
+Admin Commands{{adminSectionNote}}:{{range .Commands}}{{if and .IsAvailableCommand (requiresAdmin .)}}
+  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
+
+Flags:
+{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+
+Global Flags:
+{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+
+Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+
+Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
+`
+
+func init() {
+	cobra.AddTemplateFunc("requiresAdmin", requiresAdmin)
+	cobra.AddTemplateFunc("hasAdminCommands", hasAdminCommands)
+	cobra.AddTemplateFunc("adminSectionNote", adminSectionNote)
+	rootCmd.SetUsageTemplate(usageTemplate)
+
+	rootCmd.PersistentFlags().BoolVar(&ignoreRoleCheck, "ignore-role-check", false, "Run admin commands without checking the role in your token")
+}
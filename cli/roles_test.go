@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CheckRole(t *testing.T) {
+	adminToken := newTestJWT(map[string]interface{}{"user_role": "Admin"})
+	userToken := newTestJWT(map[string]interface{}{"user_role": "User"})
+
+	tests := []struct {
+		name         string
+		command      *cobra.Command
+		token        string
+		ignore       bool
+		expectedCode int
+	}{
+		{name: "admin runs admin command", command: NewDeleteBookCmd(nil), token: adminToken},
+		{name: "user runs user command", command: NewGetBooksCmd(nil), token: userToken},
+		{name: "user runs admin command", command: NewDeleteBookCmd(nil), token: userToken, expectedCode: exitCodeForbidden},
+		{name: "user runs admin command ignoring the check", command: NewGetUsersCmd(nil), token: userToken, ignore: true},
+		{name: "opaque token is left for the server", command: NewSaveBookCmd(nil), token: "testToken"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ignoreRoleCheck = tt.ignore
+			t.Cleanup(func() { ignoreRoleCheck = false })
+			tt.command.Flags().StringP("token", "t", tt.token, "Your jwt token")
+
+			err := checkRole(tt.command)
+			if tt.expectedCode == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			var exitErr *exitError
+			assert.True(t, errors.As(err, &exitErr))
+			assert.Equal(t, tt.expectedCode, exitErr.code)
+			assert.Contains(t, err.Error(), "requires Admin role")
+		})
+	}
+}
+
+func Test_UsageSections(t *testing.T) {
+	root := &cobra.Command{Use: "library"}
+	root.SetUsageTemplate(usageTemplate)
+	root.AddCommand(NewGetBooksCmd(nil), NewSaveBookCmd(nil), NewGetUsersCmd(nil))
+	b := bytes.NewBufferString("")
+	root.SetOut(b)
+	root.Usage()
+
+	out := b.String()
+	user := strings.Index(out, "User Commands:")
+	admin := strings.Index(out, "Admin Commands:")
+	assert.True(t, user >= 0 && admin > user)
+	assert.True(t, strings.Index(out, "get-all ") > user && strings.Index(out, "get-all ") < admin)
+	assert.True(t, strings.Index(out, "save ") > admin)
+	assert.True(t, strings.Index(out, "get-all-users ") > admin)
+}
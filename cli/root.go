@@ -1,30 +1,295 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/config"
 	"github.com/spf13/cobra"
 )
 
-var cfgFile string
+// defaultTimeout is used when neither --timeout nor the profile set one
+const defaultTimeout = 30 * time.Second
+
+var (
+	cfgFile     string
+	profileName string
+	timeout     time.Duration
+	verbosity   int
+	debug       bool
+	errorFormat = errorFormatText
+	// insecureSkipTLSVerify is deliberately only a flag, so it never ends up in a profile by accident
+	insecureSkipTLSVerify bool
+)
+
+// insecureWarning is written to stderr by every command run with --insecure-skip-tls-verify
+const insecureWarning = `WARNING: --insecure-skip-tls-verify is set, the certificate of the library REST API is NOT verified.
+Anyone between you and the server can read and change the requests, including your password and token.`
+
+// Values of --error-format
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// current holds the profile which was resolved for the running command
+var current struct {
+	name    string
+	profile config.Profile
+}
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "library",
 	Short: "cli to interact with the library REST API",
-	Long:  "cli to interact with the library REST API",
+	Long: `cli to interact with the library REST API
+
+Settings are resolved in the following order, the first one found wins:
+  1. command line flags (--config, --profile, --timeout)
+  2. LIBRARY_* environment variables
+  3. the selected profile in the config file
+  4. built-in defaults`,
+	SilenceErrors: true,
+	// usage is only printed on --help, usage errors point there instead
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadProfile(cmd); err != nil {
+			return classify(err)
+		}
+		if insecureSkipTLSVerify {
+			fmt.Fprintln(cmd.ErrOrStderr(), insecureWarning)
+		}
+		if !cmd.Flags().Changed("timeout") {
+			timeout = defaultTimeout
+			if current.profile.Timeout > 0 {
+				timeout = time.Duration(current.profile.Timeout)
+			}
+		}
+		return checkRole(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+//
+// Errors are written to stderr and the cli exits with the exit code of the error.
+// Ctrl-C cancels the requests in flight and makes the cli exit with exitCodeInterrupted.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+		// a second Ctrl-C kills the cli right away
+		signal.Stop(interrupt)
+	}()
+
+	classifyErrors(rootCmd)
+	err := rootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		err = &exitError{code: exitCodeInterrupted, message: "Interrupted", err: ctx.Err()}
+	}
+	if err == nil {
+		return
+	}
+
+	hint := ""
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) {
+		// the commands only return classified errors, so the rest comes from parsing the command line
+		err = usageError(err)
 	}
+	if exitCode(err) == exitCodeUsage {
+		cmd, _, findErr := rootCmd.Find(os.Args[1:])
+		if findErr != nil {
+			cmd = rootCmd
+		}
+		hint = fmt.Sprintf("Run '%s --help' for usage.", cmd.CommandPath())
+	}
+	reportError(os.Stderr, errorFormat, err, hint)
+	os.Exit(exitCode(err))
 }
 
-func init() {
+// classifyErrors makes the commands return an *exitError for every error
+func classifyErrors(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return classify(run(cmd, args))
+		}
+	}
+	for _, c := range cmd.Commands() {
+		classifyErrors(c)
+	}
+}
+
+// requestContext returns the context for the requests of the command
+// which is limited by --timeout or the timeout of the profile
+// and carries the --idempotency-key of the command
+func requestContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if key, _ := cmd.Flags().GetString("idempotency-key"); key != "" {
+		ctx = client.WithIdempotencyKey(ctx, key)
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// idleContext returns the context of a streamed request, which can take longer than --timeout as a whole.
+// It is canceled when nothing arrived for --timeout, touch is called on everything which arrives
+// and expired tells whether the context was canceled because of that.
+func idleContext(cmd *cobra.Command) (context.Context, context.CancelFunc, func(), func() bool) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if timeout <= 0 {
+		return ctx, cancel, func() {}, func() bool { return false }
+	}
+	var idle int32
+	timer := time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&idle, 1)
+		cancel()
+	})
+	stop := func() {
+		timer.Stop()
+		cancel()
+	}
+	return ctx, stop, func() { timer.Reset(timeout) }, func() bool { return atomic.LoadInt32(&idle) == 1 }
+}
+
+// loadProfile reads the config file and points the library clients at the selected profile
+func loadProfile(cmd *cobra.Command) error {
+	path, err := config.ResolvePath(cfgFile)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
 
+	name := cfg.SelectedProfile(profileName)
+	profile, err := cfg.Resolve(name)
+	if err != nil {
+		return err
+	}
+	current.name = name
+	current.profile = profile
+
+	opts, err := profileOptions(name, profile)
+	if err != nil {
+		return err
+	}
+	if level := debugLevel(); level > 0 {
+		opts = append(opts, client.WithMiddleware(client.Debug(cmd.ErrOrStderr(), level)))
+	}
+	client.Configure(opts...)
+	*client.API = profileEndpoint(profile)
+	return nil
+}
+
+// profileEndpoint returns where the library REST API of the profile is, the defaults fill in what it leaves out
+func profileEndpoint(profile config.Profile) client.Endpoint {
+	endpoint := client.Endpoint{BaseURL: client.DefaultBaseURL, APIVersion: client.DefaultAPIVersion}
+	if profile.BaseURL != "" {
+		endpoint.BaseURL = profile.BaseURL
+	}
+	if profile.APIVersion != "" {
+		endpoint.APIVersion = profile.APIVersion
+	}
+	return endpoint
+}
+
+// profileOptions returns the options of the http client which talks to the library REST API of the profile
+func profileOptions(name string, profile config.Profile) ([]client.Option, error) {
+	var opts []client.Option
+	if profile.MaxAttempts > 0 {
+		opts = append(opts, client.WithMaxAttempts(profile.MaxAttempts))
+	}
+
+	switch {
+	case profile.Socket != "" && profile.Proxy != "":
+		return nil, fmt.Errorf("profile %s sets both proxy and socket, only one of them can be used", name)
+	case profile.Socket != "":
+		opts = append(opts, client.WithUnixSocket(strings.TrimPrefix(profile.Socket, "unix://")))
+	case profile.Proxy != "":
+		proxy, err := url.Parse(profile.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy of profile %s: %v", name, err)
+		}
+		opts = append(opts, client.WithProxy(proxy, profile.NoProxy))
+	}
+
+	settings := client.TLSConfig{
+		CAFile:             profile.CAFile,
+		CertFile:           profile.ClientCert,
+		KeyFile:            profile.ClientKey,
+		MinVersion:         profile.MinTLSVersion,
+		Pins:               profile.Pins,
+		InsecureSkipVerify: insecureSkipTLSVerify,
+	}
+	if !settings.Empty() {
+		tlsConfig, err := settings.Build()
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS settings of profile %s: %v", name, err)
+		}
+		opts = append(opts, client.WithTLSConfig(tlsConfig))
+	}
+	return opts, nil
+}
+
+// debugLevel returns how much of the http traffic is written to stderr, --debug writes everything
+func debugLevel() int {
+	if debug && verbosity < client.DebugBodies {
+		return client.DebugBodies
+	}
+	return verbosity
+}
+
+// addIdempotencyKeyFlag adds --idempotency-key to a command which changes data with a POST request.
+// Such requests are only retried when they carry a key, so the server can tell a retry from a new request.
+func addIdempotencyKeyFlag(cmd *cobra.Command) {
+	cmd.Flags().String("idempotency-key", "", "Send the request with this Idempotency-Key header so it can be retried safely")
+}
+
+// errorFormatValue refuses values of --error-format other than text and json
+type errorFormatValue string
+
+func (f *errorFormatValue) String() string { return string(*f) }
+
+func (f *errorFormatValue) Set(value string) error {
+	if value != errorFormatText && value != errorFormatJSON {
+		return fmt.Errorf("valid formats are %s and %s", errorFormatText, errorFormatJSON)
+	}
+	*f = errorFormatValue(value)
+	return nil
+}
+
+func (f *errorFormatValue) Type() string { return "format" }
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default is $HOME/.config/library/config.json, env LIBRARY_CONFIG)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Profile from the config file to use (env LIBRARY_PROFILE)")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "How long to wait for the library REST API, 0 means no limit (default 30s or the timeout of the profile)")
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Write the http requests to stderr, -v for the requests, -vv adds headers and connection events, -vvv adds bodies")
+	addOutputFlags(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Write the http requests with headers, connection events and bodies to stderr, same as -vvv")
+	rootCmd.PersistentFlags().BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Do not verify the certificate of the library REST API, only for testing")
+	rootCmd.PersistentFlags().Var((*errorFormatValue)(&errorFormat), "error-format", "How errors are written to stderr, text or json")
 }
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// errNoPassword is returned when the password can not be read from any source
+var errNoPassword = errors.New("password is required: use -p, --password-stdin or run the command in a terminal")
+
+// addTokenFlags adds the flags which provide the jwt token of a command
+func addTokenFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("token", "t", "", "Your jwt token (default is the token stored by login)")
+	cmd.Flags().String("token-file", "", "Read your jwt token from the file")
+	cmd.Flags().Bool("token-stdin", false, "Read your jwt token from stdin")
+}
+
+// addPasswordFlags adds the flags which provide the password of a command
+func addPasswordFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("password", "p", "", "Your password (prompted for when running in a terminal)")
+	cmd.Flags().Bool("password-stdin", false, "Read your password from stdin")
+}
+
+// tokenFromInput returns the token read from --token-file or --token-stdin, or "" when neither is set.
+//
+// The token is stored in the -t flag so that stdin is only read once per command.
+func tokenFromInput(cmd *cobra.Command) (string, error) {
+	var token string
+	if path, _ := cmd.Flags().GetString("token-file"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Unable to read your token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	} else if fromStdin, _ := cmd.Flags().GetBool("token-stdin"); fromStdin {
+		data, err := ioutil.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", fmt.Errorf("Unable to read your token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	} else {
+		return "", nil
+	}
+
+	if token == "" {
+		return "", errors.New("Unable to read your token: it is empty")
+	}
+	cmd.Flags().Set("token", token)
+	return token, nil
+}
+
+// stdinFree refuses an input of the command which reads stdin when --token-stdin reads the token from it,
+// the token reader would consume the whole stream
+func stdinFree(cmd *cobra.Command, input string) error {
+	if fromStdin, _ := cmd.Flags().GetBool("token-stdin"); fromStdin {
+		return usageError(fmt.Errorf("%s and --token-stdin can not both read stdin, give the token with -t or --token-file", input))
+	}
+	return nil
+}
+
+// passwordFor returns the password given with -p or --password-stdin.
+// Without them it prompts for the password when stdin is a terminal,
+// asking twice when confirm is set.
+func passwordFor(cmd *cobra.Command, confirm bool) (string, error) {
+	if password, _ := cmd.Flags().GetString("password"); password != "" {
+		return password, nil
+	}
+	if fromStdin, _ := cmd.Flags().GetBool("password-stdin"); fromStdin {
+		return readPasswordLine(cmd.InOrStdin())
+	}
+
+	in, ok := cmd.InOrStdin().(*os.File)
+	if !ok || !isTerminal(in.Fd()) {
+		return "", errNoPassword
+	}
+	password, err := promptPassword(cmd, in, "Password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	if confirm {
+		again, err := promptPassword(cmd, in, "Confirm password: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", errors.New("passwords do not match")
+		}
+	}
+	return password, nil
+}
+
+func promptPassword(cmd *cobra.Command, in *os.File, prompt string) (string, error) {
+	fmt.Fprint(cmd.ErrOrStderr(), prompt)
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	password, err := readPassword(ctx, in.Fd())
+	// the newline typed by the user is not echoed
+	fmt.Fprintln(cmd.ErrOrStderr())
+	return password, err
+}
+
+// readPasswordLine reads the first line of r without its line ending
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishozz/library-cli/config"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PasswordFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+		err      error
+	}{{
+		name:     "password flag",
+		args:     []string{"-p", "secret"},
+		expected: "secret",
+	}, {
+		name:     "password from stdin",
+		args:     []string{"--password-stdin"},
+		stdin:    "secret\r\nignored\n",
+		expected: "secret",
+	}, {
+		name:  "empty stdin",
+		args:  []string{"--password-stdin"},
+		stdin: "",
+		err:   errors.New("password must not be empty"),
+	}, {
+		name: "stdin is not a terminal",
+		err:  errNoPassword,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addPasswordFlags(cmd)
+			assert.Nil(t, cmd.ParseFlags(tt.args))
+			cmd.SetIn(bytes.NewBufferString(tt.stdin))
+
+			password, err := passwordFor(cmd, true)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.expected, password)
+		})
+	}
+}
+
+func Test_ResolveTokenSources(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("fromFile\n"), 0600))
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		env      string
+		expected string
+	}{
+		{name: "flag wins", args: []string{"-t", "fromFlag", "--token-file", tokenFile}, env: "fromEnv", expected: "fromFlag"},
+		{name: "token file", args: []string{"--token-file", tokenFile}, env: "fromEnv", expected: "fromFile"},
+		{name: "token stdin", args: []string{"--token-stdin"}, stdin: " fromStdin\n", env: "fromEnv", expected: "fromStdin"},
+		{name: "environment", env: "fromEnv", expected: "fromEnv"},
+		{name: "stored session", expected: testToken},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(config.EnvToken, tt.env)
+			t.Cleanup(func() { os.Unsetenv(config.EnvToken) })
+			cmd := &cobra.Command{}
+			addTokenFlags(cmd)
+			assert.Nil(t, cmd.ParseFlags(tt.args))
+			cmd.SetIn(bytes.NewBufferString(tt.stdin))
+
+			token, err := resolveToken(cmd)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, token)
+
+			// stdin is only read once
+			token, err = resolveToken(cmd)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, token)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mishozz/library-cli/config"
+	"github.com/mishozz/library-cli/jwt"
+	"github.com/spf13/cobra"
+)
+
+// errNoSession is returned when no token was given and nobody is logged in
+var errNoSession = errors.New("You need to login first or provide your jwt token with -t")
+
+// defaultExpiryWarning is used when the profile does not set expiry-warning
+const defaultExpiryWarning = 5 * time.Minute
+
+// now is replaced in tests to check the token expiry
+var now = time.Now
+
+// tokenFor returns the token of the command as resolved by resolveToken.
+//
+// An expired token is refused before any request is sent
+// and a token which expires soon results in a warning on stderr.
+func tokenFor(cmd *cobra.Command) (string, error) {
+	token, err := resolveToken(cmd)
+	if err != nil {
+		return "", err
+	}
+	return checkToken(cmd, token)
+}
+
+// checkToken refuses an expired token and warns about a token which expires soon
+func checkToken(cmd *cobra.Command, token string) (string, error) {
+	claims, err := jwt.Parse(token)
+	if err != nil {
+		// not a token we understand, the library REST API will judge it
+		return token, nil
+	}
+	if claims.Expired(now()) {
+		return "", &exitError{
+			code: exitCodeAuth,
+			err:  fmt.Errorf("Your token expired %s ago at %s. Login again", expiryDistance(claims), claims.ExpiresAt.Format(time.RFC1123)),
+		}
+	}
+	if claims.ExpiresWithin(now(), expiryWarning()) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: your token expires in %s\n", expiryDistance(claims))
+	}
+	return token, nil
+}
+
+// resolveToken returns the token of the command. The first one found wins:
+// -t, --token-file, --token-stdin, LIBRARY_TOKEN and the session stored by login.
+func resolveToken(cmd *cobra.Command) (string, error) {
+	if token, _ := cmd.Flags().GetString("token"); token != "" {
+		return token, nil
+	}
+	if token, err := tokenFromInput(cmd); token != "" || err != nil {
+		return token, err
+	}
+	if token := os.Getenv(config.EnvToken); token != "" {
+		return token, nil
+	}
+
+	session, err := loadSession()
+	if err != nil {
+		return "", err
+	}
+	if session == nil {
+		return "", errNoSession
+	}
+	return session.Token, nil
+}
+
+func expiryWarning() time.Duration {
+	if current.profile.ExpiryWarning > 0 {
+		return time.Duration(current.profile.ExpiryWarning)
+	}
+	return defaultExpiryWarning
+}
+
+// expiryDistance returns the time between now and the expiry of the token rounded to seconds
+func expiryDistance(claims *jwt.Claims) time.Duration {
+	d := claims.ExpiresAt.Sub(now())
+	if d < 0 {
+		d = -d
+	}
+	return d.Round(time.Second)
+}
+
+// currentProfile returns the name of the profile resolved for the running command
+func currentProfile() string {
+	if current.name == "" {
+		return config.DefaultProfile
+	}
+	return current.name
+}
+
+func credentialsPath() (string, error) {
+	path, err := config.ResolvePath(cfgFile)
+	if err != nil {
+		return "", err
+	}
+	return config.CredentialsPath(path), nil
+}
+
+// loadSession returns the session of the current profile or nil when nobody is logged in
+func loadSession() (*config.Session, error) {
+	return loadSessionOf(currentProfile())
+}
+
+// loadSessionOf returns the session of the profile or nil when nobody is logged in to it
+func loadSessionOf(profile string) (*config.Session, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := config.LoadCredentials(path)
+	if err != nil {
+		return nil, err
+	}
+	return creds.Sessions[profile], nil
+}
+
+// saveSession stores the session for the current profile
+func saveSession(session *config.Session) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	creds, err := config.LoadCredentials(path)
+	if err != nil {
+		return err
+	}
+	creds.Sessions[currentProfile()] = session
+	return creds.Save(path)
+}
+
+// deleteSession removes the session of the current profile
+func deleteSession() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	creds, err := config.LoadCredentials(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := creds.Sessions[currentProfile()]; !ok {
+		return nil
+	}
+	delete(creds.Sessions, currentProfile())
+	return creds.Save(path)
+}
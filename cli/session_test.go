@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TokenFor(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringP("token", "t", "", "Your jwt token")
+
+	token, err := tokenFor(cmd)
+	assert.Nil(t, err)
+	assert.Equal(t, testToken, token)
+
+	cmd.Flags().Set("token", "explicit")
+	token, err = tokenFor(cmd)
+	assert.Nil(t, err)
+	assert.Equal(t, "explicit", token)
+
+	t.Cleanup(func() { storeTestSession() })
+	assert.Nil(t, deleteSession())
+	cmd.Flags().Set("token", "")
+	_, err = tokenFor(cmd)
+	assert.Equal(t, errNoSession, err)
+}
+
+// newTestJWT returns an unsigned jwt token with the given claims
+func newTestJWT(claims map[string]interface{}) string {
+	payload, _ := json.Marshal(claims)
+	return "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func Test_TokenForExpiry(t *testing.T) {
+	fixedNow := time.Unix(1610980000, 0)
+	now = func() time.Time { return fixedNow }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name           string
+		exp            time.Time
+		err            bool
+		expectedStderr string
+	}{{
+		name: "valid token",
+		exp:  fixedNow.Add(time.Hour),
+	}, {
+		name:           "token expires soon",
+		exp:            fixedNow.Add(2 * time.Minute),
+		expectedStderr: "Warning: your token expires in 2m0s\n",
+	}, {
+		name: "expired token",
+		exp:  fixedNow.Add(-time.Hour),
+		err:  true,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			token := newTestJWT(map[string]interface{}{"user_role": "User", "exp": tt.exp.Unix()})
+			cmd := &cobra.Command{}
+			cmd.Flags().StringP("token", "t", token, "Your jwt token")
+			stderr := bytes.NewBufferString("")
+			cmd.SetErr(stderr)
+
+			resolved, err := tokenFor(cmd)
+			if tt.err {
+				assert.NotNil(t, err)
+				assert.Equal(t, "", resolved)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, token, resolved)
+			}
+			assert.Equal(t, tt.expectedStderr, stderr.String())
+		})
+	}
+}
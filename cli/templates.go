@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mishozz/library-cli/jsonpath"
+)
+
+// Output formats which take a template after the =
+const (
+	outputGoTemplate     = "go-template="
+	outputGoTemplateFile = "go-template-file="
+	outputJSONPath       = "jsonpath="
+)
+
+// executor is a parsed go-template or jsonpath template
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parseTemplate returns the template of a go-template, go-template-file or jsonpath output format,
+// or nil when the format takes no template
+func parseTemplate(format string) (executor, error) {
+	switch {
+	case strings.HasPrefix(format, outputGoTemplate):
+		return newGoTemplate(strings.TrimPrefix(format, outputGoTemplate))
+	case strings.HasPrefix(format, outputGoTemplateFile):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(format, outputGoTemplateFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the template: %v", err)
+		}
+		return newGoTemplate(string(data))
+	case strings.HasPrefix(format, outputJSONPath):
+		return jsonpath.Parse(strings.TrimPrefix(format, outputJSONPath))
+	}
+	return nil, nil
+}
+
+func newGoTemplate(text string) (executor, error) {
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// templateFuncs are the helper functions of go-template output
+var templateFuncs = template.FuncMap{
+	// pad fills the value with spaces on the right up to the width, padLeft on the left
+	"pad": func(width int, value interface{}) string {
+		return fmt.Sprintf("%-*s", width, fmt.Sprint(value))
+	},
+	"padLeft": func(width int, value interface{}) string {
+		return fmt.Sprintf("%*s", width, fmt.Sprint(value))
+	},
+	// join joins the items of a list with the separator
+	"join": func(sep string, list interface{}) string {
+		items, _ := list.([]interface{})
+		texts := make([]string, len(items))
+		for i, item := range items {
+			texts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(texts, sep)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	// date formats an RFC 3339 date or unix seconds with a go layout like "2006-01-02"
+	"date": func(layout string, value interface{}) (string, error) {
+		t, err := toTime(value)
+		if err != nil {
+			return "", err
+		}
+		return t.Format(layout), nil
+	},
+	// json encodes the value as json
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date: %v is not a date", value)
+}
+
+// templateData returns the value as the maps, lists, strings, numbers and bools decoded from its json,
+// so the templates see the same field names as -o json. Whole numbers become int64.
+func templateData(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return convertNumbers(decoded), nil
+}
+
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			v[key] = convertNumbers(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = convertNumbers(v[i])
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		n, _ := v.Float64()
+		return n
+	}
+	return value
+}
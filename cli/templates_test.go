@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TemplateOutput(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "books.tmpl")
+	if err := ioutil.WriteFile(file, []byte(`{{range .}}{{pad 6 .Isbn}}|{{padLeft 4 .AvailableUnits}}|{{upper .Author}}{{"\n"}}{{end}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	user := client.User{
+		Email:      "misho@gmail.com",
+		TakenBooks: []client.BookDetails{{Isbn: "123"}, {Isbn: "456"}},
+		Extra:      map[string]json.RawMessage{"registered": json.RawMessage(`"2021-01-18T10:00:00Z"`), "tags": json.RawMessage(`["a","b"]`)},
+	}
+	books := []client.BookDetails{{Isbn: "123", Author: "Ivan Vazov", AvailableUnits: 12}}
+
+	tests := []struct {
+		name     string
+		format   string
+		items    []interface{}
+		single   bool
+		expected string
+	}{
+		{name: "template file", format: "go-template-file=" + file, items: bookItems(books), expected: "123   |  12|IVAN VAZOV\n"},
+		{name: "join and date", format: `go-template={{.Email}} {{join "," .tags}} {{date "02.01.2006" .registered}}`, items: userItems([]client.User{user}), single: true, expected: "misho@gmail.com a,b 18.01.2021"},
+		{name: "json", format: `go-template={{json (index .TakenBooks 0)}}`, items: userItems([]client.User{user}), single: true, expected: `{"Author":"","AvailableUnits":0,"Isbn":"123","Title":""}`},
+		{name: "jsonpath on a single item", format: "jsonpath={.TakenBooks[*].Isbn}", items: userItems([]client.User{user}), single: true, expected: "123 456"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := NewGetUserCmd(nil)
+			addOutputFlags(cmd.Flags())
+			cmd.Flags().Set("output", tt.format)
+			p, err := newPrinter(cmd)
+			if !assert.Nil(t, err) {
+				return
+			}
+			var buf bytes.Buffer
+			assert.Nil(t, p.print(&buf, userColumns, tt.items, tt.single))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func Test_TemplateOutputErrors(t *testing.T) {
+	for _, format := range []string{"go-template-file=/does/not/exist", "jsonpath={.[0", "go-template={{nope}}"} {
+		cmd := NewGetUserCmd(nil)
+		addOutputFlags(cmd.Flags())
+		cmd.Flags().Set("output", format)
+		_, err := newPrinter(cmd)
+		assert.NotNil(t, err, format)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package cli
+
+import (
+	"context"
+	"errors"
+)
+
+// isTerminal reports whether the file descriptor is a terminal.
+// Password prompts are not supported on this platform.
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func readPassword(ctx context.Context, fd uintptr) (string, error) {
+	return "", errors.New("password prompt is not supported on this platform")
+}
@@ -0,0 +1,96 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	termios := &syscall.Termios{}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlReadTermios, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return nil, errno
+	}
+	return termios, nil
+}
+
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlWriteTermios, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal reports whether the file descriptor is a terminal
+func isTerminal(fd uintptr) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// readPassword reads a line from the terminal with echo turned off.
+// The read can not be interrupted, so it waits in a goroutine and Ctrl-C or a canceled ctx
+// give up on it, which restores the echo before the cli exits.
+func readPassword(ctx context.Context, fd uintptr) (string, error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return "", err
+	}
+	noEcho := *old
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	if err := setTermios(fd, &noEcho); err != nil {
+		return "", err
+	}
+	defer setTermios(fd, old)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	type line struct {
+		text string
+		err  error
+	}
+	read := make(chan line, 1)
+	go func() {
+		text, err := readLine(fd)
+		read <- line{text: text, err: err}
+	}()
+	select {
+	case l := <-read:
+		return l.text, l.err
+	case <-interrupt:
+		return "", errors.New("interrupted")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// readLine reads from the file descriptor byte by byte so nothing after the newline is consumed
+func readLine(fd uintptr) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := syscall.Read(int(fd), buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if n == 0 || buf[0] == '\n' {
+			break
+		}
+		line = append(line, buf[0])
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return string(line), nil
+}
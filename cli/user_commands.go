@@ -1,46 +1,130 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/config"
+	"github.com/mishozz/library-cli/jwt"
 	"github.com/spf13/cobra"
 )
 
 // NewLoginCmd return cobra command for login
-func NewLoginCmd(client client.UserClient) *cobra.Command {
+//
+// The token returned by the library REST API is stored for the current profile
+// so the other commands can be used without -t
+func NewLoginCmd(userClient client.UserClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "login",
 		Short: "Login with username and password",
-		Long:  "Login with username and password",
-		Run: func(cmd *cobra.Command, args []string) {
-			email, _ := cmd.Flags().GetString("email")
-			password, _ := cmd.Flags().GetString("password")
+		Long:  "Login with username and password and store the session for the current profile",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, err := emailFlag(cmd)
+			if err != nil {
+				return err
+			}
+			password, err := passwordFor(cmd, false)
+			if err != nil {
+				return err
+			}
 
-			respString, err := client.Login(email, password)
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			result, err := userClient.Authenticate(ctx, email, password)
+			if err == client.ErrNoToken {
+				return fmt.Errorf("Unable to login: %w", err)
+			}
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to login. Check your username and password")
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				return failure(err, "Unable to login", "Check your username and password")
+			}
+			if err := saveSession(&config.Session{Email: email, Token: result.Token}); err != nil {
+				return fmt.Errorf("Unable to store your session: %w", err)
 			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Logged in as %s", email)
+			return nil
 		},
 	}
 }
 
 // NewLogoutCmd return cobra command for logout
-func NewLogoutCmd(client client.UserClient) *cobra.Command {
+//
+// Logging out with the stored session also deletes it
+func NewLogoutCmd(userClient client.UserClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "logout",
 		Short: "Logout",
-		Long:  "Logout from your account",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
-			respString, err := client.Logout(token)
+		Long:  "Logout from your account and delete the stored session",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := resolveToken(cmd)
+			if err != nil {
+				return err
+			}
+			session, err := loadSession()
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to logout. Check you token!")
+				return err
+			}
+
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+
+			// an expired token can not be used to logout, it only has to be forgotten
+			respString := ""
+			if claims, parseErr := jwt.Parse(token); parseErr == nil && claims.Expired(now()) {
+				err = client.UnauthorizedErr
 			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				respString, err = userClient.Logout(ctx, token)
+			}
+			if err != nil && !errors.Is(err, client.UnauthorizedErr) {
+				return failure(err, "Unable to logout", "Check you token!")
+			}
+			// an unauthorized token is already invalid, so the session can go as well
+			if session != nil && session.Token == token {
+				if err := deleteSession(); err != nil {
+					return fmt.Errorf("Unable to delete your session: %w", err)
+				}
+			}
+			fmt.Fprint(cmd.OutOrStdout(), respString)
+			return nil
+		},
+	}
+}
+
+// NewWhoamiCmd return cobra command for showing the claims of the token
+func NewWhoamiCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "whoami",
+		Short: "Show who you are logged in as",
+		Long:  "Show the identity, role and expiry of your token, decoded locally without calling the library REST API",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := resolveToken(cmd)
+			if err != nil {
+				return err
+			}
+			claims, err := jwt.Parse(token)
+			if err != nil {
+				return fmt.Errorf("Unable to decode your token: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 1, ' ', 0)
+			fmt.Fprintf(w, "Profile:\t%s\n", currentProfile())
+			if session, _ := loadSession(); session != nil && session.Token == token && session.Email != "" {
+				fmt.Fprintf(w, "Email:\t%s\n", session.Email)
+			}
+			fmt.Fprintf(w, "User ID:\t%s\n", claims.UserID)
+			fmt.Fprintf(w, "Role:\t%s\n", claims.UserRole)
+			fmt.Fprintf(w, "Auth UUID:\t%s\n", claims.AuthUUID)
+			switch {
+			case claims.ExpiresAt.IsZero():
+				fmt.Fprintf(w, "Expires:\tnever\n")
+			case claims.Expired(now()):
+				fmt.Fprintf(w, "Expires:\t%s (expired %s ago)\n", claims.ExpiresAt.Format(time.RFC1123), expiryDistance(claims))
+			default:
+				fmt.Fprintf(w, "Expires:\t%s (in %s)\n", claims.ExpiresAt.Format(time.RFC1123), expiryDistance(claims))
 			}
+			return w.Flush()
 		},
 	}
 }
@@ -50,18 +134,36 @@ func NewTakeBookCmd(client client.UserClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "take",
 		Short: "Take book",
-		Long:  "Take book from the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
-			email, _ := cmd.Flags().GetString("email")
-			isbn, _ := cmd.Flags().GetString("isbn")
+		Long: `Take book from the library
 
-			respString, err := client.TakeBook(token, email, isbn)
+Several books are taken at once with a repeated -i, a comma separated list or -i - reading the isbns from stdin.
+They are sent by --workers requests at the same time and a report of every book is printed.
+With --all-or-nothing the taken books are returned again when one of them can not be taken.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to take book from the library")
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				return err
+			}
+			email, err := emailFlag(cmd)
+			if err != nil {
+				return err
+			}
+			isbns, err := isbnListFlag(cmd)
+			if err != nil {
+				return err
+			}
+			if len(isbns) > 1 {
+				return runLoans(cmd, takeAction(client), token, email, isbns)
+			}
+
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			respString, err := client.TakeBook(ctx, token, email, isbns[0])
+			if err != nil {
+				return failure(err, "Unable to take book from the library", "")
 			}
+			fmt.Fprint(cmd.OutOrStdout(), respString)
+			return nil
 		},
 	}
 }
@@ -71,61 +173,95 @@ func NewReturnBookCmd(userClient client.UserClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "return",
 		Short: "Return book",
-		Long:  "Return book in the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
-			email, _ := cmd.Flags().GetString("email")
-			isbn, _ := cmd.Flags().GetString("isbn")
-
-			err := userClient.ReturnBook(token, email, isbn)
-			if err != nil {
-				if err == client.UnauthorizedErr {
-					fmt.Fprintf(cmd.OutOrStdout(), "You need to be authorized to access this route")
-				} else {
-					fmt.Fprintf(cmd.OutOrStdout(), "Unable to return your book")
-				}
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), "Successfully returned your book")
+		Long: `Return book in the library
+
+Several books are returned at once with a repeated -i, a comma separated list or -i - reading the isbns from stdin.
+They are sent by --workers requests at the same time and a report of every book is printed.
+With --all-or-nothing the returned books are taken again when one of them can not be returned.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			email, err := emailFlag(cmd)
+			if err != nil {
+				return err
+			}
+			isbns, err := isbnListFlag(cmd)
+			if err != nil {
+				return err
+			}
+			if len(isbns) > 1 {
+				return runLoans(cmd, returnAction(userClient), token, email, isbns)
 			}
+
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			err = userClient.ReturnBook(ctx, token, email, isbns[0])
+			if err != nil {
+				return failure(err, "Unable to return your book", "")
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Successfully returned your book")
+			return nil
 		},
 	}
 }
 
 // NewGetUsersCmd return cobra command for getting all of the users
-func NewGetUsersCmd(client client.UserClient) *cobra.Command {
+func NewGetUsersCmd(userClient client.UserClient) *cobra.Command {
 	return &cobra.Command{
-		Use:   "get-all-users",
-		Short: "Get all users",
-		Long:  "Get all users of the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
+		Use:         "get-all-users",
+		Annotations: map[string]string{roleAnnotation: adminRole},
+		Short:       "Get all users",
+		Long:        "Get all users of the library",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
 
-			respString, err := client.GetAllUsers(token)
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			users, err := userClient.SearchUsers(ctx, token, userQuery(cmd))
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to fetch users")
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				return failure(err, "Unable to fetch users", "")
 			}
+			return p.print(cmd.OutOrStdout(), userColumns, userItems(users), false)
 		},
 	}
 }
 
 // NewGetUserCmd return cobra command for getting a user
-func NewGetUserCmd(client client.UserClient) *cobra.Command {
+func NewGetUserCmd(userClient client.UserClient) *cobra.Command {
 	return &cobra.Command{
 		Use:   "get-user",
 		Short: "Get user of the library",
 		Long:  "Get user of the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			token, _ := cmd.Flags().GetString("token")
-			email, _ := cmd.Flags().GetString("email")
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := tokenFor(cmd)
+			if err != nil {
+				return err
+			}
+			email, err := emailFlag(cmd)
+			if err != nil {
+				return err
+			}
+			p, err := newPrinter(cmd)
+			if err != nil {
+				return err
+			}
 
-			respString, err := client.GetUser(token, email)
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			user, err := userClient.FindUser(ctx, token, email)
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to fetch user with email %s", email)
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				return failure(err, fmt.Sprintf("Unable to fetch user with email %s", email), "")
 			}
+			return p.print(cmd.OutOrStdout(), userColumns, userItems([]client.User{*user}), true)
 		},
 	}
 }
@@ -136,27 +272,36 @@ func NewRegisterCmd(client client.UserClient) *cobra.Command {
 		Use:   "register",
 		Short: "Register user in the library",
 		Long:  "Register user in the library",
-		Run: func(cmd *cobra.Command, args []string) {
-			email, _ := cmd.Flags().GetString("email")
-			password, _ := cmd.Flags().GetString("password")
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, err := emailFlag(cmd)
+			if err != nil {
+				return err
+			}
+			password, err := passwordFor(cmd, true)
+			if err != nil {
+				return err
+			}
 
-			respString, err := client.Register(email, password)
+			ctx, cancel := requestContext(cmd)
+			defer cancel()
+			respString, err := client.Register(ctx, email, password)
 			if err != nil {
-				fmt.Fprintf(cmd.OutOrStdout(), "Unable to register. Try again!")
-			} else {
-				fmt.Fprintf(cmd.OutOrStdout(), respString)
+				return failure(err, "Unable to register", "Try again!")
 			}
+			fmt.Fprint(cmd.OutOrStdout(), respString)
+			return nil
 		},
 	}
 }
 func init() {
-	loginCmd := NewLoginCmd(client.User)
-	logoutCmd := NewLogoutCmd(client.User)
-	takeBookCmd := NewTakeBookCmd(client.User)
-	returnBookCmd := NewReturnBookCmd(client.User)
-	getUsersCmd := NewGetUsersCmd(client.User)
-	getUserCmd := NewGetUserCmd(client.User)
-	registerCmd := NewRegisterCmd(client.User)
+	loginCmd := NewLoginCmd(client.Users)
+	logoutCmd := NewLogoutCmd(client.Users)
+	takeBookCmd := NewTakeBookCmd(client.Users)
+	returnBookCmd := NewReturnBookCmd(client.Users)
+	getUsersCmd := NewGetUsersCmd(client.Users)
+	getUserCmd := NewGetUserCmd(client.Users)
+	registerCmd := NewRegisterCmd(client.Users)
+	whoamiCmd := NewWhoamiCmd()
 
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(logoutCmd)
@@ -165,39 +310,30 @@ func init() {
 	rootCmd.AddCommand(getUsersCmd)
 	rootCmd.AddCommand(getUserCmd)
 	rootCmd.AddCommand(registerCmd)
+	rootCmd.AddCommand(whoamiCmd)
+
+	addEmailFlag(loginCmd)
+	addPasswordFlags(loginCmd)
+
+	addTokenFlags(logoutCmd)
+
+	addTokenFlags(takeBookCmd)
+	addEmailFlag(takeBookCmd)
+	addLoanFlags(takeBookCmd)
+	addIdempotencyKeyFlag(takeBookCmd)
+
+	addTokenFlags(returnBookCmd)
+	addEmailFlag(returnBookCmd)
+	addLoanFlags(returnBookCmd)
+
+	addTokenFlags(getUsersCmd)
+	addUserQueryFlags(getUsersCmd)
+
+	addTokenFlags(getUserCmd)
+	addEmailFlag(getUserCmd)
+
+	addEmailFlag(registerCmd)
+	addPasswordFlags(registerCmd)
 
-	loginCmd.Flags().StringP("email", "e", "", "Set your email")
-	loginCmd.MarkFlagRequired("email")
-	loginCmd.Flags().StringP("password", "p", "", "Enter you password")
-	loginCmd.MarkFlagRequired("password")
-
-	logoutCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	logoutCmd.MarkFlagRequired("token")
-
-	takeBookCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	takeBookCmd.Flags().StringP("email", "e", "", "Set your email")
-	takeBookCmd.Flags().StringP("isbn", "i", "", "Isbn of the book")
-	takeBookCmd.MarkFlagRequired("token")
-	takeBookCmd.MarkFlagRequired("email")
-	takeBookCmd.MarkFlagRequired("isbn")
-
-	returnBookCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	returnBookCmd.Flags().StringP("email", "e", "", "Set your email")
-	returnBookCmd.Flags().StringP("isbn", "i", "", "Isbn of the book")
-	returnBookCmd.MarkFlagRequired("token")
-	returnBookCmd.MarkFlagRequired("email")
-	returnBookCmd.MarkFlagRequired("isbn")
-
-	getUsersCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	getUsersCmd.MarkFlagRequired("token")
-
-	getUserCmd.Flags().StringP("token", "t", "", "Your jwt token")
-	getUserCmd.Flags().StringP("email", "e", "", "Set your email")
-	getUserCmd.MarkFlagRequired("token")
-	getUserCmd.MarkFlagRequired("email")
-
-	registerCmd.Flags().StringP("email", "e", "", "Set your email")
-	registerCmd.MarkFlagRequired("email")
-	registerCmd.Flags().StringP("password", "p", "", "Set you password")
-	registerCmd.MarkFlagRequired("password")
+	addTokenFlags(whoamiCmd)
 }
@@ -1,11 +1,12 @@
 package cli
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"io/ioutil"
 	"testing"
+	"time"
 
+	"github.com/mishozz/library-cli/client"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,7 +15,7 @@ type mockUserClient struct {
 	mock.Mock
 }
 
-func (m *mockUserClient) Login(username, password string) (str string, err error) {
+func (m *mockUserClient) Login(ctx context.Context, username, password string) (str string, err error) {
 	args := m.Called(username, password)
 	if args.Get(0) == nil {
 		return
@@ -22,7 +23,7 @@ func (m *mockUserClient) Login(username, password string) (str string, err error
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockUserClient) Logout(token string) (str string, err error) {
+func (m *mockUserClient) Logout(ctx context.Context, token string) (str string, err error) {
 	args := m.Called(token)
 	if args.Get(0) == nil {
 		return
@@ -30,7 +31,7 @@ func (m *mockUserClient) Logout(token string) (str string, err error) {
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockUserClient) TakeBook(token, email, isbn string) (str string, err error) {
+func (m *mockUserClient) TakeBook(ctx context.Context, token, email, isbn string) (str string, err error) {
 	args := m.Called(token, email, isbn)
 	if args.Get(0) == nil {
 		return
@@ -38,7 +39,7 @@ func (m *mockUserClient) TakeBook(token, email, isbn string) (str string, err er
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockUserClient) ReturnBook(token, email, isbn string) (err error) {
+func (m *mockUserClient) ReturnBook(ctx context.Context, token, email, isbn string) (err error) {
 	args := m.Called(token, email, isbn)
 	if args.Get(0) == nil {
 		return
@@ -46,7 +47,7 @@ func (m *mockUserClient) ReturnBook(token, email, isbn string) (err error) {
 	return args.Error(0)
 }
 
-func (m *mockUserClient) GetAllUsers(token string) (str string, err error) {
+func (m *mockUserClient) GetAllUsers(ctx context.Context, token string) (str string, err error) {
 	args := m.Called(token)
 	if args.Get(0) == nil {
 		return
@@ -54,7 +55,7 @@ func (m *mockUserClient) GetAllUsers(token string) (str string, err error) {
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockUserClient) GetUser(token, email string) (str string, err error) {
+func (m *mockUserClient) GetUser(ctx context.Context, token, email string) (str string, err error) {
 	args := m.Called(token, email)
 	if args.Get(0) == nil {
 		return
@@ -62,7 +63,7 @@ func (m *mockUserClient) GetUser(token, email string) (str string, err error) {
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockUserClient) Register(email, password string) (str string, err error) {
+func (m *mockUserClient) Register(ctx context.Context, email, password string) (str string, err error) {
 	args := m.Called(email, email)
 	if args.Get(0) == nil {
 		return
@@ -70,76 +71,124 @@ func (m *mockUserClient) Register(email, password string) (str string, err error
 	return args.Get(0).(string), args.Error(1)
 }
 
+func (m *mockUserClient) Authenticate(ctx context.Context, email, password string) (*client.LoginResult, error) {
+	args := m.Called(email, password)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*client.LoginResult), args.Error(1)
+}
+
+func (m *mockUserClient) ListUsers(ctx context.Context, token string) ([]client.User, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]client.User), args.Error(1)
+}
+
+func (m *mockUserClient) FindUser(ctx context.Context, token, email string) (*client.User, error) {
+	args := m.Called(token, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*client.User), args.Error(1)
+}
+
+func (m *mockUserClient) SearchUsers(ctx context.Context, token string, query client.UserQuery) ([]client.User, error) {
+	args := m.Called(token, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]client.User), args.Error(1)
+}
+
 func Test_GetAllUsers(t *testing.T) {
 	tests := []struct {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("GetAllUsers", mock.Anything).Return("users", nil)
+			m.On("SearchUsers", mock.Anything, mock.Anything).Return([]client.User{
+				{Email: "misho@gmail.com", Role: "Admin", TakenBooks: []client.BookDetails{{Isbn: "123"}, {Isbn: "456"}}},
+				{Email: "ivan@gmail.com", Role: "User"},
+			}, nil)
 			return m
 		},
-		expectedOutput: "users",
+		expectedOutput: "EMAIL             ROLE    BOOKS\nmisho@gmail.com   Admin   2\nivan@gmail.com    User    0\n",
 	}, {
 		name: "error while fetching users",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("GetAllUsers", mock.Anything).Return("", errors.New("error"))
+			m.On("SearchUsers", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to fetch users",
+		expectedError: "Unable to fetch users",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
 			getAllBooksCmd := NewGetUsersCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
 
+func Test_GetAllUsersFilters(t *testing.T) {
+	hasLoans := false
+	m := &mockUserClient{}
+	m.On("SearchUsers", mock.Anything, client.UserQuery{EmailContains: "gmail", HasLoans: &hasLoans}).Return([]client.User{{Email: "ivan@gmail.com", Role: "User"}}, nil)
+	getUsersCmd := NewGetUsersCmd(m)
+	addUserQueryFlags(getUsersCmd)
+	addOutputFlags(getUsersCmd.Flags())
+	getUsersCmd.Flags().Set("email-contains", "gmail")
+	getUsersCmd.Flags().Set("has-loans", "false")
+	getUsersCmd.Flags().Set("output", "jsonpath={.[*].Email}")
+	out, err := execute(getUsersCmd)
+	assert.Nil(t, err)
+	assert.Equal(t, "ivan@gmail.com", out)
+}
+
 func Test_GetUser(t *testing.T) {
 	tests := []struct {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("GetUser", mock.Anything, mock.Anything).Return("user", nil)
+			m.On("FindUser", mock.Anything, "Misho+Books@gmail.com").Return(&client.User{
+				Email: "misho@gmail.com", Role: "Admin", TakenBooks: []client.BookDetails{{Isbn: "123"}, {Isbn: "456"}},
+			}, nil)
 			return m
 		},
-		expectedOutput: "user",
+		expectedOutput: "EMAIL             ROLE    BOOKS   ISBNS\nmisho@gmail.com   Admin   2       123,456\n",
 	}, {
 		name: "error while fetching user",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("GetUser", mock.Anything, mock.Anything).Return("", errors.New("error"))
+			m.On("FindUser", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to fetch user with email ",
+		expectedError: "Unable to fetch user with email Misho+Books@gmail.com",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
 			getAllBooksCmd := NewGetUserCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			addEmailFlag(getAllBooksCmd)
+			getAllBooksCmd.Flags().Set("email", testEmail)
+			addOutputFlags(getAllBooksCmd.Flags())
+			getAllBooksCmd.Flags().Set("output", "wide")
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -149,34 +198,48 @@ func Test_Login(t *testing.T) {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("Login", mock.Anything, mock.Anything).Return("testToken", nil)
+			m.On("Authenticate", "Misho+Books@gmail.com", mock.Anything).Return(&client.LoginResult{Token: "testToken"}, nil)
 			return m
 		},
-		expectedOutput: "testToken",
+		expectedOutput: "Logged in as Misho+Books@gmail.com",
+	}, {
+		name: "response without token",
+		mockUserClient: func(m *mockUserClient) *mockUserClient {
+			m.On("Authenticate", mock.Anything, mock.Anything).Return(nil, client.ErrNoToken)
+			return m
+		},
+		expectedError: "Unable to login: login response does not contain a token",
 	}, {
 		name: "wrong credentials",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("Login", mock.Anything, mock.Anything).Return("", errors.New("error"))
+			m.On("Authenticate", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+			return m
+		},
+		expectedError: "Unable to login. Check your username and password",
+	}, {
+		name: "rejected by the server",
+		mockUserClient: func(m *mockUserClient) *mockUserClient {
+			m.On("Authenticate", mock.Anything, mock.Anything).Return(nil, &client.APIError{StatusCode: 401, Message: "wrong password"})
 			return m
 		},
-		expectedOutput: "Unable to login. Check your username and password",
+		expectedError: "Unable to login: wrong password (401 Unauthorized)",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
 			getAllBooksCmd := NewLoginCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			addEmailFlag(getAllBooksCmd)
+			addPasswordFlags(getAllBooksCmd)
+			getAllBooksCmd.Flags().Set("email", testEmail)
+			getAllBooksCmd.Flags().Set("password", "secret")
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -186,6 +249,7 @@ func Test_Logout(t *testing.T) {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
@@ -199,21 +263,17 @@ func Test_Logout(t *testing.T) {
 			m.On("Logout", mock.Anything).Return("", errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to logout. Check you token!",
+		expectedError: "Unable to logout. Check you token!",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
+			t.Cleanup(func() { storeTestSession() })
 			getAllBooksCmd := NewLogoutCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -223,10 +283,11 @@ func Test_TakeBook(t *testing.T) {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("TakeBook", mock.Anything, mock.Anything, mock.Anything).Return("success", nil)
+			m.On("TakeBook", mock.Anything, "Misho+Books@gmail.com", "9780306406157").Return("success", nil)
 			return m
 		},
 		expectedOutput: "success",
@@ -236,21 +297,20 @@ func Test_TakeBook(t *testing.T) {
 			m.On("TakeBook", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("", errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to take book from the library",
+		expectedError: "Unable to take book from the library",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
 			getAllBooksCmd := NewTakeBookCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			addEmailFlag(getAllBooksCmd)
+			addLoanFlags(getAllBooksCmd)
+			getAllBooksCmd.Flags().Set("email", testEmail)
+			getAllBooksCmd.Flags().Set("isbn", testISBN)
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -260,10 +320,11 @@ func Test_ReturnBook(t *testing.T) {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
-			m.On("ReturnBook", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			m.On("ReturnBook", mock.Anything, "Misho+Books@gmail.com", "9780306406157").Return(nil)
 			return m
 		},
 		expectedOutput: "Successfully returned your book",
@@ -273,21 +334,20 @@ func Test_ReturnBook(t *testing.T) {
 			m.On("ReturnBook", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("error"))
 			return m
 		},
-		expectedOutput: "Unable to return your book",
+		expectedError: "Unable to return your book",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
 			getAllBooksCmd := NewReturnBookCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			getAllBooksCmd.SetOut(b)
-			getAllBooksCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			addEmailFlag(getAllBooksCmd)
+			addLoanFlags(getAllBooksCmd)
+			getAllBooksCmd.Flags().Set("email", testEmail)
+			getAllBooksCmd.Flags().Set("isbn", testISBN)
+			out, err := execute(getAllBooksCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -297,6 +357,7 @@ func Test_Register(t *testing.T) {
 		name           string
 		mockUserClient func(m *mockUserClient) *mockUserClient
 		expectedOutput string
+		expectedError  string
 	}{{
 		name: "success",
 		mockUserClient: func(m *mockUserClient) *mockUserClient {
@@ -310,21 +371,64 @@ func Test_Register(t *testing.T) {
 			m.On("Register", mock.Anything, mock.Anything).Return("", errors.New("err"))
 			return m
 		},
-		expectedOutput: "Unable to register. Try again!",
+		expectedError: "Unable to register. Try again!",
 	}}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			m := &mockUserClient{}
 			registerCmd := NewRegisterCmd(tt.mockUserClient(m))
-			b := bytes.NewBufferString("")
-			registerCmd.SetOut(b)
-			registerCmd.Execute()
-			out, err := ioutil.ReadAll(b)
-			if err != nil {
-				t.Fatal(err)
-			}
-			assert.Equal(t, tt.expectedOutput, string(out))
+			addEmailFlag(registerCmd)
+			addPasswordFlags(registerCmd)
+			registerCmd.Flags().Set("email", testEmail)
+			registerCmd.Flags().Set("password", "secret")
+			out, err := execute(registerCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
+		})
+	}
+}
+
+func Test_Whoami(t *testing.T) {
+	fixedNow := time.Unix(1610980000, 0)
+	now = func() time.Time { return fixedNow }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedOutput string
+		expectedError  string
+	}{{
+		name: "valid token",
+		token: newTestJWT(map[string]interface{}{
+			"user_id":   1,
+			"user_role": "Admin",
+			"auth_uuid": "65402de9-7028-4931-9681-b8915527cea3",
+			"exp":       fixedNow.Add(90 * time.Minute).Unix(),
+		}),
+		expectedOutput: "Profile:   default\n" +
+			"User ID:   1\n" +
+			"Role:      Admin\n" +
+			"Auth UUID: 65402de9-7028-4931-9681-b8915527cea3\n" +
+			"Expires:   " + fixedNow.Add(90*time.Minute).Format(time.RFC1123) + " (in 1h30m0s)\n",
+	}, {
+		name:           "expired token",
+		token:          newTestJWT(map[string]interface{}{"user_id": 2, "user_role": "User", "exp": fixedNow.Add(-time.Minute).Unix()}),
+		expectedOutput: "Profile:   default\nUser ID:   2\nRole:      User\nAuth UUID: \nExpires:   " + fixedNow.Add(-time.Minute).Format(time.RFC1123) + " (expired 1m0s ago)\n",
+	}, {
+		name:          "opaque token",
+		token:         "testToken",
+		expectedError: "Unable to decode your token: malformed jwt token",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			whoamiCmd := NewWhoamiCmd()
+			whoamiCmd.Flags().StringP("token", "t", tt.token, "Your jwt token")
+			out, err := execute(whoamiCmd)
+			assert.Equal(t, tt.expectedOutput, out)
+			assertError(t, tt.expectedError, err)
 		})
 	}
 }
@@ -2,30 +2,39 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 )
 
-const (
-	host         = "http://localhost:"
-	port         = "8080"
-	libraryApiV1 = "/library/api/v1/"
-)
-
 // BookClient is an interface with methods which will call the library REST API
 //
 // we can use this interface to mock out unit testing calls
 type BookClient interface {
-	GetAllBooks(token string) (string, error)
-	GetBook(token, isbn string) (string, error)
-	SaveBook(token, isbn, title, author string, availableUnits uint) (string, error)
-	Delete(token, isbn string) error
+	GetAllBooks(ctx context.Context, token string) (string, error)
+	GetBook(ctx context.Context, token, isbn string) (string, error)
+	SaveBook(ctx context.Context, token, isbn, title, author string, availableUnits uint) (string, error)
+	Delete(ctx context.Context, token, isbn string) error
+
+	// ListBooks is GetAllBooks with the response decoded
+	ListBooks(ctx context.Context, token string) ([]BookDetails, error)
+	// FindBook is GetBook with the response decoded
+	FindBook(ctx context.Context, token, isbn string) (*BookDetails, error)
+	// SearchBooks is ListBooks with the books filtered, sorted and paged by the query
+	SearchBooks(ctx context.Context, token string, query BookQuery) ([]BookDetails, error)
+	// UpdateBook changes the fields of the book set in the update and returns the updated book
+	UpdateBook(ctx context.Context, token, isbn string, update BookUpdate) (*BookDetails, error)
+	// StreamBooks is SearchBooks which passes the books to each while the response is read,
+	// so large catalogs are not held in memory unless the client has to sort them
+	StreamBooks(ctx context.Context, token string, query BookQuery, each func(book BookDetails) error) error
 }
 
 type bookClient struct {
 	client HTTPClient
+	api    *Endpoint
 }
 
 // BookDetails holds the details of a book so we can parse it to json
@@ -34,35 +43,77 @@ type BookDetails struct {
 	Title          string `json:"Title"`
 	Author         string `json:"Author"`
 	AvailableUnits uint   `json:"AvailableUnits" `
+
+	// Extra holds the fields returned by the library REST API which are not known to the cli
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON accepts the field names in any case, e.g. both "AvailableUnits" and "available_units",
+// and keeps the unknown fields in Extra
+func (b *BookDetails) UnmarshalJSON(data []byte) error {
+	var book BookDetails
+	extra, err := decodeFields(data, map[string]interface{}{
+		"isbn":           &book.Isbn,
+		"title":          &book.Title,
+		"author":         &book.Author,
+		"availableunits": &book.AvailableUnits,
+	})
+	if err != nil {
+		return err
+	}
+	book.Extra = extra
+	*b = book
+	return nil
+}
+
+// MarshalJSON encodes the known fields in PascalCase followed by the fields in Extra
+func (b BookDetails) MarshalJSON() ([]byte, error) {
+	return encodeFields([]field{
+		{"Isbn", b.Isbn},
+		{"Title", b.Title},
+		{"Author", b.Author},
+		{"AvailableUnits", b.AvailableUnits},
+	}, b.Extra)
 }
 
 // Books is book cline which can be used for mocking
 var Books BookClient = &bookClient{
 	client: HTTP,
+	api:    API,
 }
 
-func (b bookClient) GetAllBooks(token string) (string, error) {
-	req, _ := http.NewRequest("GET", host+port+libraryApiV1+"books", nil)
-	setAuthHeader(token, req)
+// NewBookClient returns a book client which sends its requests with the http client to the endpoint,
+// e.g. to talk to another library REST API than Books
+func NewBookClient(httpClient HTTPClient, api *Endpoint) BookClient {
+	return &bookClient{client: httpClient, api: api}
+}
+
+func (b bookClient) GetAllBooks(ctx context.Context, token string) (string, error) {
+	return b.getBooks(ctx, token, b.api.url("books"))
+}
 
-	respString, err := b.client.SendRequest(req)
+func (b bookClient) getBooks(ctx context.Context, token, rawURL string) (string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+
+	respString, err := b.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (b bookClient) GetBook(token, isbn string) (string, error) {
-	req, _ := http.NewRequest("GET", host+port+libraryApiV1+"books/"+isbn, nil)
-	setAuthHeader(token, req)
+func (b bookClient) GetBook(ctx context.Context, token, isbn string) (string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "GET", b.api.url("books", isbn), nil)
 
-	respString, err := b.client.SendRequest(req)
+	respString, err := b.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
-func (b bookClient) SaveBook(token, isbn, title, author string, availableUnits uint) (string, error) {
+func (b bookClient) SaveBook(ctx context.Context, token, isbn, title, author string, availableUnits uint) (string, error) {
 	book := &BookDetails{
 		Isbn:           isbn,
 		Title:          title,
@@ -74,35 +125,270 @@ func (b bookClient) SaveBook(token, isbn, title, author string, availableUnits u
 		return "", err
 	}
 
-	req, _ := http.NewRequest("POST", host+port+libraryApiV1+"books", bytes.NewBuffer(jsonData))
-	setAuthHeader(token, req)
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "POST", b.api.url("books"), bytes.NewBuffer(jsonData))
 
-	respString, err := b.client.SendRequest(req)
+	respString, err := b.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (b bookClient) Delete(token, isbn string) error {
-	req, _ := http.NewRequest("DELETE", host+port+libraryApiV1+"books/"+isbn, nil)
-	setAuthHeader(token, req)
+func (b bookClient) Delete(ctx context.Context, token, isbn string) error {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "DELETE", b.api.url("books", isbn), nil)
+
+	resp, err := b.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	return checkResponse(req, resp)
+}
+
+func (b bookClient) ListBooks(ctx context.Context, token string) ([]BookDetails, error) {
+	return b.listBooks(ctx, token, b.api.url("books"))
+}
+
+func (b bookClient) listBooks(ctx context.Context, token, rawURL string) ([]BookDetails, error) {
+	respString, err := b.getBooks(ctx, token, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	books := []BookDetails{}
+	if err := decodeList([]byte(respString), &books, "books", "data", "items"); err != nil {
+		return nil, fmt.Errorf("unable to decode books: %v", err)
+	}
+	return books, nil
+}
 
-	resp, err := b.client.Do(req)
+// SearchBooks sends the parts of the query the library REST API advertises with QueryParamsHeader
+// as query parameters and does the rest on the client
+func (b bookClient) SearchBooks(ctx context.Context, token string, query BookQuery) ([]BookDetails, error) {
+	rawURL, query := b.searchURL(ctx, token, query)
+	books, err := b.listBooks(ctx, token, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(books), nil
+}
+
+// searchURL returns the url of the books with the query parameters the server supports
+// and the query which is left for the client
+func (b bookClient) searchURL(ctx context.Context, token string, query BookQuery) (string, BookQuery) {
+	rawURL := b.api.url("books")
+	if filters, paging := query.params(); len(filters)+len(paging) > 0 {
+		params, pagedByServer := serverParams(supportedParams(ctx, b.client, b.api, token, "books"), filters, paging)
+		rawURL = withQuery(rawURL, params)
+		if pagedByServer {
+			query.SortBy, query.Reverse, query.Limit, query.Offset = "", false, 0, 0
+		}
+	}
+	return rawURL, query
+}
+
+// errEnoughBooks stops reading the books when the limit of the query is reached
+var errEnoughBooks = errors.New("enough books")
+
+func (b bookClient) StreamBooks(ctx context.Context, token string, query BookQuery, each func(book BookDetails) error) error {
+	rawURL, query := b.searchURL(ctx, token, query)
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	resp, err := b.client.Do(ctx, req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if err := checkResponse(req, resp); err != nil {
+		return err
+	}
 
-	if resp.StatusCode == http.StatusUnauthorized {
-		return UnauthorizedErr
-	} else if resp.StatusCode != http.StatusNoContent {
-		return errors.New("Unable to delete book")
+	// sorting needs all the books, the others are passed on as soon as they are decoded
+	var sorted []BookDetails
+	var eachErr error
+	skipped, sent := 0, 0
+	err = streamList(resp.Body, func(item json.RawMessage) error {
+		var book BookDetails
+		if err := json.Unmarshal(item, &book); err != nil {
+			return err
+		}
+		switch {
+		case !query.matches(book):
+			return nil
+		case query.ordered():
+			sorted = append(sorted, book)
+			return nil
+		case skipped < query.Offset:
+			skipped++
+			return nil
+		}
+		if eachErr = each(book); eachErr != nil {
+			return eachErr
+		}
+		if sent++; query.Limit > 0 && sent == query.Limit {
+			return errEnoughBooks
+		}
+		return nil
+	}, "books", "data", "items")
+	switch {
+	case eachErr != nil:
+		return eachErr
+	case err != nil && err != errEnoughBooks:
+		return fmt.Errorf("unable to decode books: %v", err)
 	}
 
+	for _, book := range query.Apply(sorted) {
+		if err := each(book); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func setAuthHeader(token string, req *http.Request) {
-	tokenString := fmt.Sprintf("Bearer %v", token)
-	req.Header.Set("Authorization", tokenString)
+func (b bookClient) FindBook(ctx context.Context, token, isbn string) (*BookDetails, error) {
+	respString, err := b.GetBook(ctx, token, isbn)
+	if err != nil {
+		return nil, err
+	}
+	book := &BookDetails{}
+	if err := json.Unmarshal([]byte(respString), book); err != nil {
+		return nil, fmt.Errorf("unable to decode book: %v", err)
+	}
+	return book, nil
+}
+
+// BookUpdate holds the changes made by UpdateBook, the fields which are nil stay as they are
+type BookUpdate struct {
+	Title  *string
+	Author *string
+	// AvailableUnits sets the units, AddUnits changes them by an amount which is negative for removing units
+	AvailableUnits *uint
+	AddUnits       int
+	// Expected is the book as the caller last saw it. When it is set the update stops
+	// when the title, author or units of the book are not the expected ones any more.
+	Expected *BookDetails
+}
+
+// Empty reports whether the update does not change anything
+func (u BookUpdate) Empty() bool {
+	return u.Title == nil && u.Author == nil && u.AvailableUnits == nil && u.AddUnits == 0
+}
+
+// changedSince reports whether the book differs from the one the caller expects
+func (u BookUpdate) changedSince(book BookDetails) bool {
+	if u.Expected == nil {
+		return false
+	}
+	return book.Title != u.Expected.Title || book.Author != u.Expected.Author || book.AvailableUnits != u.Expected.AvailableUnits
+}
+
+// apply returns a copy of the book with the update made
+func (u BookUpdate) apply(book BookDetails) (BookDetails, error) {
+	if u.Title != nil {
+		book.Title = *u.Title
+	}
+	if u.Author != nil {
+		book.Author = *u.Author
+	}
+	if u.AvailableUnits != nil {
+		book.AvailableUnits = *u.AvailableUnits
+	}
+	if u.AddUnits < 0 && uint(-u.AddUnits) > book.AvailableUnits {
+		return book, fmt.Errorf("%w: %d units can not be removed, only %d are available", ErrNotEnoughUnits, -u.AddUnits, book.AvailableUnits)
+	}
+	book.AvailableUnits = uint(int(book.AvailableUnits) + u.AddUnits)
+	return book, nil
+}
+
+// ErrNotEnoughUnits is returned by UpdateBook when more units are removed than are available
+var ErrNotEnoughUnits = errors.New("not enough units")
+
+// ErrBookChanged is returned by UpdateBook when the book was changed by someone else
+// between reading and updating it. It matches ErrConflict.
+var ErrBookChanged error = conflictError("the book was changed by someone else in the meantime")
+
+type conflictError string
+
+func (e conflictError) Error() string {
+	return string(e)
+}
+
+func (e conflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// UpdateBook reads the book, makes the update and writes it back with PUT.
+//
+// The update stops when the book read is not update.Expected. When the library REST API sends an ETag
+// the book is written with If-Match, so the server refuses the update when the book changed after
+// it was read. Without an ETag nothing protects the update from a change made in between.
+func (b bookClient) UpdateBook(ctx context.Context, token, isbn string, update BookUpdate) (*BookDetails, error) {
+	book, etag, err := b.readBook(ctx, token, isbn)
+	if err != nil {
+		return nil, err
+	}
+	if update.changedSince(*book) {
+		return nil, ErrBookChanged
+	}
+	updated, err := update.apply(*book)
+	if err != nil {
+		return nil, err
+	}
+	if update.Empty() {
+		return book, nil
+	}
+
+	jsonData, err := json.Marshal(updated)
+	if err != nil {
+		return nil, err
+	}
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "PUT", b.api.url("books", isbn), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	respString, err := b.client.SendRequest(ctx, req)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed {
+		return nil, ErrBookChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	// servers which answer with the stored book win over what was sent
+	result := &BookDetails{}
+	if json.Unmarshal([]byte(respString), result) != nil || result.Isbn == "" {
+		result = &updated
+	}
+	return result, nil
+}
+
+// readBook returns the book with the ETag of the response
+func (b bookClient) readBook(ctx context.Context, token, isbn string) (*BookDetails, string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "GET", b.api.url("books", isbn), nil)
+
+	resp, err := b.client.Do(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(req, resp); err != nil {
+		return nil, "", err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	book := &BookDetails{}
+	if err := json.Unmarshal(body, book); err != nil {
+		return nil, "", fmt.Errorf("unable to decode book: %v", err)
+	}
+	return book, resp.Header.Get("ETag"), nil
 }
@@ -1,8 +1,13 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,7 +18,7 @@ type mockHTTPClient struct {
 	mock.Mock
 }
 
-func (m *mockHTTPClient) SendRequest(req *http.Request) (str string, err error) {
+func (m *mockHTTPClient) SendRequest(ctx context.Context, req *http.Request) (str string, err error) {
 	args := m.Called(req)
 	if args.Get(0) == nil {
 		return
@@ -21,7 +26,7 @@ func (m *mockHTTPClient) SendRequest(req *http.Request) (str string, err error)
 	return args.Get(0).(string), args.Error(1)
 }
 
-func (m *mockHTTPClient) Do(req *http.Request) (res *http.Response, err error) {
+func (m *mockHTTPClient) Do(ctx context.Context, req *http.Request) (res *http.Response, err error) {
 	args := m.Called(req)
 	if args.Get(0) == nil {
 		return
@@ -59,7 +64,7 @@ func Test_BookClient_GetAllBook(t *testing.T) {
 			b := &bookClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := b.GetAllBooks("test")
+			respStr, err := b.GetAllBooks(context.Background(), "test")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -98,7 +103,7 @@ func Test_BookClient_GetBook(t *testing.T) {
 			b := &bookClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := b.GetBook("test", "isbn")
+			respStr, err := b.GetBook(context.Background(), "test", "isbn")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -149,7 +154,7 @@ func Test_BookClient_SaveBook(t *testing.T) {
 			b := &bookClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := b.SaveBook("test", tt.isbn, tt.title, tt.author, tt.units)
+			respStr, err := b.SaveBook(context.Background(), "test", tt.isbn, tt.title, tt.author, tt.units)
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -176,14 +181,24 @@ func Test_BookClient_DeleteBook(t *testing.T) {
 			m.On("Do", mock.Anything).Return(&http.Response{StatusCode: 401}, nil)
 			return m
 		},
-		err: errors.New("Unauthorized"),
+		err: UnauthorizedErr,
 	}, {
 		name: "unable to delete book",
 		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
-			m.On("Do", mock.Anything).Return(&http.Response{StatusCode: 500}, nil)
+			m.On("Do", mock.Anything).Return(&http.Response{
+				StatusCode: 500,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":"database is down"}`)),
+			}, nil)
 			return m
 		},
-		err: errors.New("Unable to delete book"),
+		err: ErrServer,
+	}, {
+		name: "book not found",
+		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
+			m.On("Do", mock.Anything).Return(&http.Response{StatusCode: 404}, nil)
+			return m
+		},
+		err: ErrNotFound,
 	}}
 	for _, tt := range tests {
 		tt := tt
@@ -192,12 +207,201 @@ func Test_BookClient_DeleteBook(t *testing.T) {
 			b := &bookClient{
 				client: tt.mockHTTPClient(m),
 			}
-			err := b.Delete("test", "isbn")
-			if err != nil {
-				assert.EqualError(t, err, tt.err.Error())
+			err := b.Delete(context.Background(), "test", "isbn")
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err))
 			} else {
 				assert.Nil(t, err)
 			}
 		})
 	}
 }
+
+func Test_BookClient_ListBooks(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockHTTPClient func(m *mockHTTPClient) *mockHTTPClient
+		expected       []BookDetails
+		err            error
+	}{{
+		name: "pascal case fields",
+		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
+			m.On("SendRequest", mock.Anything).Return(`[{"Isbn":"123","Title":"Pod igoto","Author":"Ivan Vazov","AvailableUnits":3}]`, nil)
+			return m
+		},
+		expected: []BookDetails{{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 3}},
+	}, {
+		name: "lowercase fields wrapped in an object with unknown fields",
+		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
+			m.On("SendRequest", mock.Anything).Return(`{"books":[{"isbn":"123","title":"Pod igoto","author":"Ivan Vazov","available_units":3,"year":1894}]}`, nil)
+			return m
+		},
+		expected: []BookDetails{{
+			Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 3,
+			Extra: map[string]json.RawMessage{"year": json.RawMessage("1894")},
+		}},
+	}, {
+		name: "empty library",
+		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
+			m.On("SendRequest", mock.Anything).Return(`[]`, nil)
+			return m
+		},
+		expected: []BookDetails{},
+	}, {
+		name: "not a list",
+		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
+			m.On("SendRequest", mock.Anything).Return(`internal error`, nil)
+			return m
+		},
+		err: errors.New("unable to decode books: invalid character 'i' looking for beginning of value"),
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockHTTPClient{}
+			b := &bookClient{
+				client: tt.mockHTTPClient(m),
+			}
+			books, err := b.ListBooks(context.Background(), "test")
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, books)
+		})
+	}
+}
+
+func Test_BookClient_FindBook(t *testing.T) {
+	m := &mockHTTPClient{}
+	m.On("SendRequest", mock.Anything).Return(`{"ISBN":"123","title":"Pod igoto","Author":"Ivan Vazov","availableUnits":2}`, nil)
+	b := &bookClient{client: m}
+
+	book, err := b.FindBook(context.Background(), "test", "123")
+	assert.Nil(t, err)
+	assert.Equal(t, &BookDetails{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 2}, book)
+}
+
+func Test_BookDetails_MarshalJSON(t *testing.T) {
+	book := BookDetails{
+		Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 2,
+		Extra: map[string]json.RawMessage{"year": json.RawMessage("1894"), "genre": json.RawMessage(`"novel"`)},
+	}
+	data, err := json.Marshal(book)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Isbn":"123","Title":"Pod igoto","Author":"Ivan Vazov","AvailableUnits":2,"genre":"novel","year":1894}`, string(data))
+}
+
+func Test_BookClient_UpdateBook(t *testing.T) {
+	title := "Pod igoto"
+	units := uint(5)
+	stored := `{"Isbn":"123","Title":"Pod igot","Author":"Ivan Vazov","AvailableUnits":2,"year":1894}`
+	tests := []struct {
+		name     string
+		etag     string
+		update   BookUpdate
+		status   int
+		expected *BookDetails
+		sent     string
+		err      error
+		// stored replaces the book of the server
+		stored string
+	}{{
+		name:     "if-match with the etag",
+		etag:     `"v1"`,
+		update:   BookUpdate{Title: &title, AddUnits: 3},
+		expected: &BookDetails{Isbn: "123", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 5, Extra: map[string]json.RawMessage{"year": json.RawMessage("1894")}},
+		sent:     `{"Isbn":"123","Title":"Pod igoto","Author":"Ivan Vazov","AvailableUnits":5,"year":1894}`,
+	}, {
+		name:   "etag does not match any more",
+		etag:   `"v1"`,
+		update: BookUpdate{Title: &title},
+		status: http.StatusPreconditionFailed,
+		err:    ErrBookChanged,
+	}, {
+		name:     "without an etag",
+		update:   BookUpdate{AvailableUnits: &units},
+		expected: &BookDetails{Isbn: "123", Title: "Pod igot", Author: "Ivan Vazov", AvailableUnits: 5, Extra: map[string]json.RawMessage{"year": json.RawMessage("1894")}},
+		sent:     `{"Isbn":"123","Title":"Pod igot","Author":"Ivan Vazov","AvailableUnits":5,"year":1894}`,
+	}, {
+		// the fields are compared, not the bytes of the response
+		name:     "expected book in another field order",
+		stored:   `{"AvailableUnits":2, "Author":"Ivan Vazov", "Title":"Pod igot", "Isbn":"123"}`,
+		update:   BookUpdate{AvailableUnits: &units, Expected: &BookDetails{Isbn: "123", Title: "Pod igot", Author: "Ivan Vazov", AvailableUnits: 2}},
+		expected: &BookDetails{Isbn: "123", Title: "Pod igot", Author: "Ivan Vazov", AvailableUnits: 5},
+		sent:     `{"Isbn":"123","Title":"Pod igot","Author":"Ivan Vazov","AvailableUnits":5}`,
+	}, {
+		name:   "changed since the caller saw it",
+		update: BookUpdate{AvailableUnits: &units, Expected: &BookDetails{Isbn: "123", Title: "Pod igot", Author: "Ivan Vazov", AvailableUnits: 1}},
+		err:    ErrBookChanged,
+	}, {
+		name:   "changed since the caller saw it with an etag",
+		etag:   `"v2"`,
+		update: BookUpdate{Title: &title, Expected: &BookDetails{Isbn: "123", Title: "Pod", Author: "Ivan Vazov", AvailableUnits: 2}},
+		err:    ErrBookChanged,
+	}, {
+		name:   "not enough units",
+		update: BookUpdate{AddUnits: -3},
+		err:    ErrNotEnoughUnits,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			reads := 0
+			var sent, ifMatch string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					reads++
+					if tt.etag != "" {
+						w.Header().Set("ETag", tt.etag)
+					}
+					if tt.stored != "" {
+						w.Write([]byte(tt.stored))
+						return
+					}
+					w.Write([]byte(stored))
+				case http.MethodPut:
+					body, _ := ioutil.ReadAll(r.Body)
+					sent, ifMatch = string(body), r.Header.Get("If-Match")
+					if tt.status != 0 {
+						w.WriteHeader(tt.status)
+						return
+					}
+					w.Write(body)
+				}
+			}))
+			defer server.Close()
+			b := &bookClient{client: NewHTTPClient(), api: &Endpoint{BaseURL: server.URL, APIVersion: "v1"}}
+
+			book, err := b.UpdateBook(context.Background(), "test", "123", tt.update)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "unexpected error %v", err)
+				if tt.err == ErrBookChanged && tt.status == 0 {
+					assert.Empty(t, sent, "the book must not be written")
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, book)
+			assert.Equal(t, tt.sent, sent)
+			assert.Equal(t, tt.etag, ifMatch)
+			assert.Equal(t, 1, reads)
+		})
+	}
+	assert.True(t, errors.Is(ErrBookChanged, ErrConflict))
+}
+
+func Test_BookClient_EscapesPath(t *testing.T) {
+	var requestURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	b := &bookClient{client: NewHTTPClient(), api: &Endpoint{BaseURL: server.URL, APIVersion: "v1"}}
+
+	assert.Nil(t, b.Delete(context.Background(), "test", "123/copies?all=1"))
+	assert.Equal(t, "/library/api/v1/books/123%2Fcopies%3Fall=1", requestURI)
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Debug levels which select how much of every request and response is written by Debug
+const (
+	// DebugRequests writes the method, url, status and timing
+	DebugRequests = 1
+	// DebugHeaders adds the headers and the connection events traced with net/http/httptrace
+	DebugHeaders = 2
+	// DebugBodies adds the bodies
+	DebugBodies = 3
+)
+
+// redacted replaces secrets in the debug output
+const redacted = "[REDACTED]"
+
+// maxDebugBody limits how much of a body is written by Debug
+const maxDebugBody = 4096
+
+// Debug writes every request and response to w, each line prefixed with the number of the request.
+//
+// Secrets are redacted so the output can be shared: the Authorization and cookie headers,
+// passwords and tokens in json bodies, anything which looks like a jwt and the non json responses to login.
+func Debug(w io.Writer, level int) Middleware {
+	var mu sync.Mutex
+	var counter int32
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if level < DebugRequests {
+				return next.RoundTrip(req)
+			}
+			d := &debugLog{w: w, mu: &mu, id: atomic.AddInt32(&counter, 1), start: time.Now()}
+
+			d.printf("--> %s %s", req.Method, req.URL)
+			if level >= DebugHeaders {
+				d.headers(req.Header)
+				req = req.WithContext(httptrace.WithClientTrace(req.Context(), d.trace()))
+			}
+			if level >= DebugBodies && req.GetBody != nil {
+				if body, err := req.GetBody(); err == nil {
+					data, _ := ioutil.ReadAll(body)
+					body.Close()
+					d.body(redactBody(data, false))
+				}
+			}
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				d.printf("<-- error after %s: %v", d.elapsed(), err)
+				return nil, err
+			}
+			d.printf("<-- %s (%s)", resp.Status, d.elapsed())
+			if level >= DebugHeaders {
+				d.headers(resp.Header)
+			}
+			if level >= DebugBodies && resp.Body != nil {
+				data, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+				if err != nil {
+					d.printf("<-- error while reading the body: %v", err)
+					return nil, err
+				}
+				d.body(redactBody(data, strings.HasSuffix(req.URL.Path, "/login")))
+			}
+			return resp, nil
+		})
+	}
+}
+
+// debugLog writes the lines of a single request
+type debugLog struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	id    int32
+	start time.Time
+}
+
+func (d *debugLog) printf(format string, args ...interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.w, "[%d] %s\n", d.id, fmt.Sprintf(format, args...))
+}
+
+func (d *debugLog) elapsed() time.Duration {
+	return time.Since(d.start).Round(time.Microsecond)
+}
+
+func (d *debugLog) headers(header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			d.printf("    %s: %s", key, redactHeader(key, value))
+		}
+	}
+}
+
+func (d *debugLog) body(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	truncated := ""
+	if len(data) > maxDebugBody {
+		truncated = fmt.Sprintf(" ... (%d more bytes)", len(data)-maxDebugBody)
+		data = data[:maxDebugBody]
+	}
+	d.printf("    %s%s", data, truncated)
+}
+
+// trace reports the connection events of the request
+func (d *debugLog) trace() *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart time.Time
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			d.printf("* getting connection to %s", hostPort)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				d.printf("* DNS lookup failed after %s: %v", since(dnsStart), info.Err)
+				return
+			}
+			addrs := make([]string, 0, len(info.Addrs))
+			for _, addr := range info.Addrs {
+				addrs = append(addrs, addr.String())
+			}
+			d.printf("* DNS lookup resolved %s in %s", strings.Join(addrs, ", "), since(dnsStart))
+		},
+		ConnectStart: func(network, addr string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				d.printf("* connecting to %s failed after %s: %v", addr, since(connectStart), err)
+				return
+			}
+			d.printf("* connected to %s in %s", addr, since(connectStart))
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				d.printf("* TLS handshake failed after %s: %v", since(tlsStart), err)
+				return
+			}
+			d.printf("* TLS handshake done in %s: %s, %s", since(tlsStart), tlsVersion(state.Version), tls.CipherSuiteName(state.CipherSuite))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				d.printf("* reusing connection to %s", info.Conn.RemoteAddr())
+			}
+		},
+		GotFirstResponseByte: func() {
+			d.printf("* first response byte after %s", d.elapsed())
+		},
+	}
+}
+
+func since(t time.Time) time.Duration {
+	return time.Since(t).Round(time.Microsecond)
+}
+
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS 0x%04x", version)
+}
+
+// redactHeader hides the value of headers which carry credentials
+func redactHeader(key, value string) string {
+	switch http.CanonicalHeaderKey(key) {
+	case "Authorization", "Proxy-Authorization":
+		if i := strings.IndexByte(value, ' '); i > 0 {
+			return value[:i+1] + redacted
+		}
+		return redacted
+	case "Cookie", "Set-Cookie":
+		return redacted
+	}
+	return value
+}
+
+// sensitiveKeys are the normalized json keys whose values are redacted
+var sensitiveKeys = map[string]bool{
+	"password":     true,
+	"token":        true,
+	"accesstoken":  true,
+	"refreshtoken": true,
+	"idtoken":      true,
+	"jwt":          true,
+	"secret":       true,
+}
+
+var jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// redactBody hides passwords and tokens in a json body and everything which looks like a jwt.
+// The non json response to login is the bare token, so it is hidden completely.
+func redactBody(data []byte, login bool) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		if _, ok := value.(string); !ok || !login {
+			if redactedJSON, err := json.Marshal(redactValue(value)); err == nil {
+				return redactedJSON
+			}
+		}
+	}
+	if login && len(bytes.TrimSpace(data)) > 0 {
+		return []byte(redacted)
+	}
+	return jwtPattern.ReplaceAll(data, []byte(redacted))
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveKeys[normalizeKey(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	case string:
+		return jwtPattern.ReplaceAllString(v, redacted)
+	}
+	return value
+}
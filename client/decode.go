@@ -0,0 +1,165 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// normalizeKey makes "AvailableUnits", "availableUnits" and "available_units" the same key
+func normalizeKey(key string) string {
+	key = strings.ToLower(key)
+	key = strings.Replace(key, "_", "", -1)
+	return strings.Replace(key, "-", "", -1)
+}
+
+// decodeFields decodes a json object into the known fields, matching the keys
+// regardless of their case or separators. The fields which are not known are returned.
+func decodeFields(data []byte, known map[string]interface{}) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var extra map[string]json.RawMessage
+	for key, value := range fields {
+		target, ok := known[normalizeKey(key)]
+		if !ok {
+			if extra == nil {
+				extra = map[string]json.RawMessage{}
+			}
+			extra[key] = value
+			continue
+		}
+		if bytes.Equal(value, []byte("null")) {
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return nil, fmt.Errorf("field %s: %v", key, err)
+		}
+	}
+	return extra, nil
+}
+
+// encodeFields encodes the known fields in the given order followed by the extra fields sorted by key
+func encodeFields(known []field, extra map[string]json.RawMessage) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	write := func(key string, value interface{}) error {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+		return nil
+	}
+
+	for _, f := range known {
+		if err := write(f.key, f.value); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := write(key, extra[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// decodeList decodes a json array, or an object which wraps the array in one of the wrapper keys
+func decodeList(data []byte, list interface{}, wrappers ...string) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+		for key, value := range object {
+			for _, wrapper := range wrappers {
+				if normalizeKey(key) == wrapper {
+					return json.Unmarshal(value, list)
+				}
+			}
+		}
+		return fmt.Errorf("expected a list but got an object")
+	}
+	return json.Unmarshal(data, list)
+}
+
+// streamList decodes the items of a json array one at a time like decodeList, so the list is never held in memory.
+// each is called with every item and the decoding stops at the first error it returns.
+func streamList(r io.Reader, each func(item json.RawMessage) error, wrappers ...string) error {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('{') {
+		return streamArray(decoder, token, each)
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		for _, wrapper := range wrappers {
+			if normalizeKey(key.(string)) == wrapper {
+				if token, err = decoder.Token(); err != nil {
+					return err
+				}
+				return streamArray(decoder, token, each)
+			}
+		}
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("expected a list but got an object")
+}
+
+// streamArray decodes the items of the array whose opening token was read already
+func streamArray(decoder *json.Decoder, first json.Token, each func(item json.RawMessage) error) error {
+	if first == nil {
+		// null is an empty list like for json.Unmarshal
+		return nil
+	}
+	if first != json.Delim('[') {
+		return fmt.Errorf("expected a list but got %v", first)
+	}
+	for decoder.More() {
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return err
+		}
+		if err := each(item); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultBaseURL is the address of the library REST API when no profile overrides it
+	DefaultBaseURL = "http://localhost:8080"
+	// DefaultAPIVersion is the version of the library REST API when no profile overrides it
+	DefaultAPIVersion = "v1"
+)
+
+// Endpoint describes where the library REST API can be reached
+type Endpoint struct {
+	BaseURL    string
+	APIVersion string
+}
+
+// API is the endpoint used by the Books and User clients
+var API = &Endpoint{
+	BaseURL:    DefaultBaseURL,
+	APIVersion: DefaultAPIVersion,
+}
+
+// url returns the address of a resource of the library REST API built from path segments
+// like "users", email and isbn. Every segment is escaped, so a slash or ? in a value stays part of it.
+// A nil endpoint falls back to API.
+func (e *Endpoint) url(segments ...string) string {
+	if e == nil {
+		e = API
+	}
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return strings.TrimRight(e.BaseURL, "/") + "/library/api/" + e.APIVersion + "/" + strings.Join(escaped, "/")
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Endpoint_URL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint *Endpoint
+		segments []string
+		expected string
+	}{{
+		name:     "default endpoint",
+		endpoint: nil,
+		segments: []string{"books"},
+		expected: "http://localhost:8080/library/api/v1/books",
+	}, {
+		name:     "custom endpoint",
+		endpoint: &Endpoint{BaseURL: "https://library.example.com/", APIVersion: "v2"},
+		segments: []string{"users", "misho+library@gmail.com"},
+		expected: "https://library.example.com/library/api/v2/users/misho+library@gmail.com",
+	}, {
+		name:     "escaped segments",
+		endpoint: &Endpoint{BaseURL: "http://localhost:8080", APIVersion: "v1"},
+		segments: []string{"books", "123/456?x=1 #"},
+		expected: "http://localhost:8080/library/api/v1/books/123%2F456%3Fx=1%20%23",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.endpoint.url(tt.segments...))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by APIError with errors.Is
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrConflict  = errors.New("conflict")
+	ErrServer    = errors.New("server error")
+)
+
+// maxMessageLength limits how much of a plain text body ends up in the message
+const maxMessageLength = 200
+
+// APIError is returned when the library REST API answers with an error status code
+type APIError struct {
+	StatusCode int
+	// Message is the error message sent by the server, it is empty when there is none
+	Message string
+	Method  string
+	Path    string
+	// Body is the raw body of the response
+	Body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Description())
+}
+
+// Description returns the server message followed by the status, e.g. "book not found (404 Not Found)"
+func (e *APIError) Description() string {
+	status := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message == "" {
+		return status
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, status)
+}
+
+// Is makes errors.Is match the sentinel error of the status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case UnauthorizedErr:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// checkResponse returns an APIError when the status code of the response is not a success.
+// The body is only consumed in that case.
+func checkResponse(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+	var body []byte
+	if resp.Body != nil {
+		body, _ = ioutil.ReadAll(resp.Body)
+	}
+	return newAPIError(req, resp.StatusCode, body)
+}
+
+func newAPIError(req *http.Request, statusCode int, body []byte) *APIError {
+	return &APIError{
+		StatusCode: statusCode,
+		Message:    serverMessage(body),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Body:       string(body),
+	}
+}
+
+// serverMessage extracts the error message from a json body like {"error": "..."} or a plain text body
+func serverMessage(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &fields); err == nil {
+		for _, key := range []string{"error", "message", "msg", "detail"} {
+			if message, ok := fields[key].(string); ok && message != "" {
+				return message
+			}
+		}
+		return ""
+	}
+	if strings.HasPrefix(text, "<") {
+		// an html error page is not a message
+		return ""
+	}
+	if len(text) > maxMessageLength {
+		text = text[:maxMessageLength] + "..."
+	}
+	return text
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CheckResponse(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost:8080/library/api/v1/books/123", nil)
+	tests := []struct {
+		name                string
+		statusCode          int
+		body                string
+		expectedMessage     string
+		expectedDescription string
+		sentinel            error
+	}{{
+		name:       "success",
+		statusCode: 200,
+		body:       `{"Isbn":"123"}`,
+	}, {
+		name:                "json error",
+		statusCode:          404,
+		body:                `{"error":"book not found"}`,
+		expectedMessage:     "book not found",
+		expectedDescription: "book not found (404 Not Found)",
+		sentinel:            ErrNotFound,
+	}, {
+		name:                "plain text error",
+		statusCode:          409,
+		body:                "book already exists\n",
+		expectedMessage:     "book already exists",
+		expectedDescription: "book already exists (409 Conflict)",
+		sentinel:            ErrConflict,
+	}, {
+		name:                "html error page",
+		statusCode:          502,
+		body:                "<html><body>Bad Gateway</body></html>",
+		expectedDescription: "502 Bad Gateway",
+		sentinel:            ErrServer,
+	}, {
+		name:                "forbidden without body",
+		statusCode:          403,
+		expectedDescription: "403 Forbidden",
+		sentinel:            ErrForbidden,
+	}, {
+		name:                "unauthorized",
+		statusCode:          401,
+		body:                `{"message":"token expired"}`,
+		expectedMessage:     "token expired",
+		expectedDescription: "token expired (401 Unauthorized)",
+		sentinel:            UnauthorizedErr,
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.statusCode, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+			err := checkResponse(req, resp)
+			if tt.sentinel == nil {
+				assert.Nil(t, err)
+				return
+			}
+
+			var apiErr *APIError
+			assert.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tt.statusCode, apiErr.StatusCode)
+			assert.Equal(t, tt.expectedMessage, apiErr.Message)
+			assert.Equal(t, tt.expectedDescription, apiErr.Description())
+			assert.Equal(t, "GET", apiErr.Method)
+			assert.Equal(t, "/library/api/v1/books/123", apiErr.Path)
+			assert.Equal(t, tt.body, apiErr.Body)
+			assert.True(t, errors.Is(err, tt.sentinel))
+			assert.Equal(t, "GET /library/api/v1/books/123: "+tt.expectedDescription, err.Error())
+
+			for _, other := range []error{UnauthorizedErr, ErrForbidden, ErrNotFound, ErrConflict, ErrServer} {
+				if other != tt.sentinel {
+					assert.False(t, errors.Is(err, other))
+				}
+			}
+		})
+	}
+}
@@ -1,31 +1,87 @@
 package client
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 // HTTPClient can be used to mock out unit testing calls
 type HTTPClient interface {
-	SendRequest(req *http.Request) (string, error)
-	Do(req *http.Request) (*http.Response, error)
+	SendRequest(ctx context.Context, req *http.Request) (string, error)
+	Do(ctx context.Context, req *http.Request) (*http.Response, error)
 }
 
 // Implements the HttpClient interface methods
 type httpClient struct {
 	client *http.Client
+	retry  RetryPolicy
+	// transport sends the requests after they went through the middleware
+	transport  http.RoundTripper
+	middleware []Middleware
 }
 
 // HTTP is http client which can be used for mocking
-var HTTP HTTPClient = &httpClient{client: &http.Client{}}
+var HTTP HTTPClient = NewHTTPClient()
 
-func (h httpClient) Do(req *http.Request) (*http.Response, error) {
-	return h.client.Do(req)
+// Do sends http request which is canceled together with the context.
+// Failed requests are retried according to the RetryPolicy of the client.
+func (h httpClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	if key := idempotencyKeyFrom(ctx); key != "" && req.Header.Get(IdempotencyKeyHeader) == "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := h.client.Do(req)
+		last := attempt >= h.retry.MaxAttempts || !retryable(req)
+		if err != nil {
+			if last || !isConnectionError(err) {
+				return nil, err
+			}
+		} else if last || !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		wait := h.retry.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp, time.Now()); ok {
+				// a server which asks for a longer wait than MaxDelay gets its answer back instead
+				if d > h.retry.MaxDelay {
+					return resp, nil
+				}
+				wait = d
+			}
+			discard(resp)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rewind returns a copy of the request with a fresh body so it can be sent again
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
 }
 
-// SendRequest sends http request and returns the body of the response as a string
-func (h httpClient) SendRequest(req *http.Request) (string, error) {
-	resp, err := h.client.Do(req)
+// SendRequest sends http request and returns the body of the response as a string.
+// Error status codes result in an *APIError.
+func (h httpClient) SendRequest(ctx context.Context, req *http.Request) (string, error) {
+	resp, err := h.Do(ctx, req)
 	if err != nil {
 		return "", err
 	}
@@ -35,6 +91,9 @@ func (h httpClient) SendRequest(req *http.Request) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", newAPIError(req, resp.StatusCode, bodyBytes)
+	}
 	bodyString := string(bodyBytes)
 
 	return bodyString, nil
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HTTPClient_SendRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/books":
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"book not found"}`))
+		}
+	}))
+	defer server.Close()
+	h := &httpClient{client: server.Client()}
+
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	body, err := h.SendRequest(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "[]", body)
+
+	req, _ = http.NewRequest("GET", server.URL+"/books/123", nil)
+	body, err = h.SendRequest(context.Background(), req)
+	assert.Equal(t, "", body)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "book not found", apiErr.Message)
+	assert.Equal(t, "/books/123", apiErr.Path)
+}
+
+func Test_HTTPClient_ContextCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	h := &httpClient{client: server.Client()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	_, err := h.SendRequest(ctx, req)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// RequestIDHeader carries the id which identifies a request in the logs of the client and the server
+const RequestIDHeader = "X-Request-ID"
+
+// Version is the version of the client sent in the User-Agent header.
+// It is set at build time with -ldflags "-X github.com/mishozz/library-cli/client.Version=1.0.0"
+var Version = "dev"
+
+// Middleware wraps the RoundTripper which sends the requests of an http client.
+// It can change the request before passing it on, inspect the response or stop the request.
+//
+// Middleware must not modify the request it receives, it has to clone it first as required by http.RoundTripper.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc turns a function into an http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// chain wraps the transport with the middleware, the first middleware sees the request first
+func chain(transport http.RoundTripper, middleware []Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return transport
+}
+
+// setHeader returns a copy of the request with the header set unless the request has it already
+func setHeader(req *http.Request, key, value string) *http.Request {
+	if req.Header.Get(key) != "" {
+		return req
+	}
+	clone := req.Clone(req.Context())
+	clone.Header.Set(key, value)
+	return clone
+}
+
+type tokenKey struct{}
+
+// WithToken returns a context which makes the requests sent with it carry the jwt token
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// AuthHeader sets the Authorization header from the token stored in the context of the request by WithToken
+func AuthHeader() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if token, _ := req.Context().Value(tokenKey{}).(string); token != "" {
+				req = setHeader(req, "Authorization", "Bearer "+token)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// UserAgent sets the User-Agent header to the product and version followed by the go version and platform,
+// e.g. "library-cli/1.0.0 (go1.15; linux/amd64)"
+func UserAgent(product, version string) Middleware {
+	userAgent := fmt.Sprintf("%s/%s (%s; %s/%s)", product, version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return next.RoundTrip(setHeader(req, "User-Agent", userAgent))
+		})
+	}
+}
+
+// RequestID sets the X-Request-ID header to a random id unless the request has one
+func RequestID() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) == "" {
+				req = setHeader(req, RequestIDHeader, newRequestID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// Latency calls observe with the time it took to get the response headers of every request,
+// retries are observed one by one
+func Latency(observe func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			observe(req, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HTTPClient_DefaultMiddleware(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	books := &bookClient{
+		client: NewHTTPClient(),
+		api:    &Endpoint{BaseURL: server.URL, APIVersion: "v1"},
+	}
+
+	_, err := books.GetAllBooks(context.Background(), "testToken")
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer testToken", header.Get("Authorization"))
+	assert.True(t, strings.HasPrefix(header.Get("User-Agent"), "library-cli/"+Version+" (go"))
+	assert.Len(t, header.Get(RequestIDHeader), 32)
+}
+
+func Test_HTTPClient_WithMiddleware(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(setHeader(req, "X-"+name, "yes"))
+			})
+		}
+	}
+	var elapsed time.Duration
+	var status int
+	latency := Latency(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		elapsed = d
+		status = resp.StatusCode
+	})
+	h := NewHTTPClient(WithMiddleware(trace("First"), trace("Second"), latency))
+
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	req.Header.Set(RequestIDHeader, "my-request")
+	resp, err := h.Do(context.Background(), req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"First", "Second"}, order)
+	assert.Equal(t, "yes", header.Get("X-First"))
+	assert.Equal(t, "yes", header.Get("X-Second"))
+	assert.Equal(t, "my-request", header.Get(RequestIDHeader))
+	assert.Equal(t, "", header.Get("Authorization"))
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.True(t, elapsed > 0)
+	// the request of the caller is left alone
+	assert.Equal(t, "", req.Header.Get("X-First"))
+}
+
+func Test_HTTPClient_MiddlewareStopsRequest(t *testing.T) {
+	h := NewHTTPClient(WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusForbidden,
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		})
+	}))
+
+	req, _ := http.NewRequest("GET", "http://library.invalid/books", nil)
+	_, err := h.SendRequest(context.Background(), req)
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
+
+func Test_Configure(t *testing.T) {
+	saved := *HTTP.(*httpClient)
+	t.Cleanup(func() { *HTTP.(*httpClient) = saved })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	seen := 0
+	count := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			seen++
+			return next.RoundTrip(req)
+		})
+	}
+	Configure(WithMaxAttempts(1), WithMiddleware(count))
+	Configure(WithMiddleware(count))
+
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	resp, err := HTTP.Do(context.Background(), req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, seen, "the middleware of the first call is dropped")
+	assert.Equal(t, DefaultRetryPolicy, HTTP.(*httpClient).retry)
+}
@@ -0,0 +1,76 @@
+package client
+
+import "net/http"
+
+// Option configures an http client created by NewHTTPClient, or HTTP with Configure
+type Option func(h *httpClient)
+
+// defaultMiddleware is the middleware every http client starts with
+func defaultMiddleware() []Middleware {
+	return []Middleware{
+		AuthHeader(),
+		UserAgent("library-cli", Version),
+		RequestID(),
+	}
+}
+
+// NewHTTPClient returns an http client configured with the options.
+//
+// Requests go through AuthHeader, UserAgent and RequestID before the middleware added with WithMiddleware.
+func NewHTTPClient(opts ...Option) HTTPClient {
+	h := &httpClient{
+		client:     &http.Client{},
+		retry:      DefaultRetryPolicy,
+		middleware: defaultMiddleware(),
+	}
+	h.apply(opts)
+	return h
+}
+
+// Configure sets up HTTP, the http client of Books and Users, with the options like NewHTTPClient does.
+// The options of an earlier call are dropped, so calling it again does not stack middleware or transports.
+// It does nothing when HTTP was replaced by another implementation.
+func Configure(opts ...Option) {
+	h, ok := HTTP.(*httpClient)
+	if !ok {
+		return
+	}
+	*h = *NewHTTPClient(opts...).(*httpClient)
+}
+
+// apply applies the options and rebuilds the middleware chain
+func (h *httpClient) apply(opts []Option) {
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.client.Transport = chain(h.transport, h.middleware)
+}
+
+// WithRetryPolicy sets how failed requests are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(h *httpClient) {
+		h.retry = policy
+	}
+}
+
+// WithMaxAttempts sets how many times a request is sent at most, 1 disables retries
+func WithMaxAttempts(attempts int) Option {
+	return func(h *httpClient) {
+		h.retry.MaxAttempts = attempts
+	}
+}
+
+// WithMiddleware adds middleware to the end of the chain, so it sees the requests after the middleware added before
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(h *httpClient) {
+		h.middleware = append(h.middleware, middleware...)
+	}
+}
+
+// WithTransport sets the RoundTripper which sends the requests after they went through the middleware,
+// http.DefaultTransport is used by default
+func WithTransport(transport http.RoundTripper) Option {
+	return func(h *httpClient) {
+		h.transport = transport
+	}
+}
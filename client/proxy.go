@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithProxy sends the requests through the proxy, except the ones to hosts matched by noProxy.
+//
+// noProxy is a comma separated list like NO_PROXY: "*" matches every host, IP addresses and CIDR ranges
+// match the addresses, "example.com" matches the domain and its subdomains, ".example.com" only the subdomains
+// and an optional ":port" limits an entry to the port. Requests to localhost and loopback addresses
+// are never sent through the proxy.
+func WithProxy(proxy *url.URL, noProxy string) Option {
+	bypass := parseNoProxy(noProxy)
+	return func(h *httpClient) {
+		transport := h.httpTransport()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypass.match(req.URL) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+		h.transport = transport
+	}
+}
+
+// WithUnixSocket connects to the unix socket at path instead of the host of the requests.
+// The urls keep their host, which the server sees in the Host header.
+func WithUnixSocket(path string) Option {
+	return func(h *httpClient) {
+		transport := h.httpTransport()
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		h.transport = transport
+	}
+}
+
+// httpTransport returns a copy of the transport of the client to change.
+// A transport set with WithTransport which is not an *http.Transport is replaced by http.DefaultTransport.
+func (h *httpClient) httpTransport() *http.Transport {
+	transport, ok := h.transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	return transport.Clone()
+}
+
+// noProxy holds the parsed entries of a NO_PROXY list
+type noProxy struct {
+	all     bool
+	entries []noProxyEntry
+}
+
+type noProxyEntry struct {
+	network *net.IPNet
+	ip      net.IP
+	// domain matches the host and its subdomains, or only the subdomains when it starts with a dot
+	domain string
+	port   string
+}
+
+func parseNoProxy(value string) noProxy {
+	var n noProxy
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			n.all = true
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			n.entries = append(n.entries, noProxyEntry{network: network})
+			continue
+		}
+		host, port := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, port = h, p
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			n.entries = append(n.entries, noProxyEntry{ip: ip, port: port})
+			continue
+		}
+		n.entries = append(n.entries, noProxyEntry{domain: strings.TrimPrefix(host, "*"), port: port})
+	}
+	return n
+}
+
+// match reports whether requests to the url go around the proxy
+func (n noProxy) match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	ip := net.ParseIP(host)
+	if n.all || host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+
+	for _, entry := range n.entries {
+		if entry.port != "" && entry.port != port {
+			continue
+		}
+		switch {
+		case entry.network != nil:
+			if ip != nil && entry.network.Contains(ip) {
+				return true
+			}
+		case entry.ip != nil:
+			if ip != nil && entry.ip.Equal(ip) {
+				return true
+			}
+		case strings.HasPrefix(entry.domain, "."):
+			if strings.HasSuffix(host, entry.domain) {
+				return true
+			}
+		default:
+			if host == entry.domain || strings.HasSuffix(host, "."+entry.domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
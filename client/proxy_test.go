@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NoProxy(t *testing.T) {
+	tests := []struct {
+		name     string
+		noProxy  string
+		url      string
+		expected bool
+	}{
+		{name: "empty list", url: "http://library.example.com", expected: false},
+		{name: "localhost", url: "http://localhost:8080", expected: true},
+		{name: "loopback", url: "http://127.0.0.1:8080", expected: true},
+		{name: "everything", noProxy: "*", url: "https://library.example.com", expected: true},
+		{name: "domain", noProxy: "example.com", url: "https://example.com", expected: true},
+		{name: "subdomain", noProxy: "other.org, example.com", url: "https://library.example.com", expected: true},
+		{name: "suffix is not a subdomain", noProxy: "example.com", url: "https://library-example.com", expected: false},
+		{name: "leading dot", noProxy: ".example.com", url: "https://example.com", expected: false},
+		{name: "leading dot subdomain", noProxy: ".example.com", url: "https://library.example.com", expected: true},
+		{name: "wildcard subdomain", noProxy: "*.example.com", url: "https://library.example.com", expected: true},
+		{name: "case", noProxy: "Example.COM", url: "https://LIBRARY.example.com", expected: true},
+		{name: "port", noProxy: "example.com:8443", url: "https://example.com:8443", expected: true},
+		{name: "other port", noProxy: "example.com:8443", url: "https://example.com", expected: false},
+		{name: "default port", noProxy: "example.com:443", url: "https://example.com", expected: true},
+		{name: "ip", noProxy: "10.0.0.5", url: "http://10.0.0.5:8080", expected: true},
+		{name: "cidr", noProxy: "10.0.0.0/8", url: "http://10.1.2.3", expected: true},
+		{name: "outside cidr", noProxy: "10.0.0.0/8", url: "http://192.168.1.1", expected: false},
+		{name: "ipv6", noProxy: "[2001:db8::1]:8080", url: "http://[2001:db8::1]:8080", expected: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, parseNoProxy(tt.noProxy).match(u))
+		})
+	}
+}
+
+func Test_WithProxy(t *testing.T) {
+	var proxied *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r
+		w.Write([]byte(`[]`))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	books := &bookClient{
+		client: NewHTTPClient(WithProxy(proxyURL, "internal.example.com")),
+		api:    &Endpoint{BaseURL: "http://library.example.com", APIVersion: "v1"},
+	}
+	_, err := books.GetAllBooks(context.Background(), "testToken")
+	assert.Nil(t, err)
+	if assert.NotNil(t, proxied) {
+		assert.Equal(t, "http://library.example.com/library/api/v1/books", proxied.RequestURI)
+		assert.Equal(t, "Bearer testToken", proxied.Header.Get("Authorization"))
+	}
+
+	transport := books.client.(*httpClient).transport.(*http.Transport)
+	req, _ := http.NewRequest(http.MethodGet, "http://internal.example.com/library/api/v1/books", nil)
+	bypassed, err := transport.Proxy(req)
+	assert.Nil(t, err)
+	assert.Nil(t, bypassed)
+}
+
+func Test_WithUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "library.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	var host, path string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, path = r.Host, r.URL.Path
+		w.Write([]byte(`[{"isbn": "123"}]`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	books := &bookClient{
+		client: NewHTTPClient(WithUnixSocket(socket)),
+		api:    &Endpoint{BaseURL: "http://library.example.com", APIVersion: "v1"},
+	}
+	list, err := books.ListBooks(context.Background(), "testToken")
+	assert.Nil(t, err)
+	assert.Equal(t, []BookDetails{{Isbn: "123"}}, list)
+	assert.Equal(t, "library.example.com", host)
+	assert.Equal(t, "/library/api/v1/books", path)
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryParamsHeader is the header with which the library REST API advertises the query parameters
+// its collections support, e.g. "author, title, available, sort, order, limit, offset".
+// It is read from the response to an OPTIONS request on the collection.
+const QueryParamsHeader = "X-Query-Params"
+
+// Book sort keys of BookQuery
+const (
+	SortByIsbn   = "isbn"
+	SortByTitle  = "title"
+	SortByAuthor = "author"
+	SortByUnits  = "units"
+)
+
+// BookSortKeys are the values accepted by BookQuery.SortBy
+var BookSortKeys = []string{SortByIsbn, SortByTitle, SortByAuthor, SortByUnits}
+
+// BookQuery selects, orders and pages the books returned by SearchBooks
+type BookQuery struct {
+	// Author and Title match a part of the field regardless of the case
+	Author string
+	Title  string
+	// Available selects the books with available units when true and the ones out of stock when false
+	Available *bool
+	// SortBy is one of BookSortKeys, the order of the server is kept when it is empty
+	SortBy  string
+	Reverse bool
+	// Limit is the maximum number of books, 0 means no limit
+	Limit  int
+	Offset int
+}
+
+// UserQuery selects the users returned by SearchUsers
+type UserQuery struct {
+	// EmailContains matches a part of the email regardless of the case
+	EmailContains string
+	// HasLoans selects the users who have taken books when true and the ones who have not when false
+	HasLoans *bool
+}
+
+// params returns the query parameters of the filters and of the order and pages
+func (q BookQuery) params() (filters, paging url.Values) {
+	filters, paging = url.Values{}, url.Values{}
+	if q.Author != "" {
+		filters.Set("author", q.Author)
+	}
+	if q.Title != "" {
+		filters.Set("title", q.Title)
+	}
+	if q.Available != nil {
+		filters.Set("available", strconv.FormatBool(*q.Available))
+	}
+	if q.SortBy != "" {
+		paging.Set("sort", q.SortBy)
+	}
+	// without sort the server reverses its own order
+	if q.Reverse {
+		paging.Set("order", "desc")
+	}
+	if q.Limit > 0 {
+		paging.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		paging.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return filters, paging
+}
+
+// Apply filters, sorts and pages the books on the client
+func (q BookQuery) Apply(books []BookDetails) []BookDetails {
+	books = q.filter(books)
+	q.sort(books)
+
+	start := q.Offset
+	if start > len(books) {
+		start = len(books)
+	}
+	end := len(books)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+	}
+	return books[start:end]
+}
+
+func (q BookQuery) filter(books []BookDetails) []BookDetails {
+	selected := []BookDetails{}
+	for _, book := range books {
+		if q.matches(book) {
+			selected = append(selected, book)
+		}
+	}
+	return selected
+}
+
+// matches reports whether the book passes the filters of the query
+func (q BookQuery) matches(book BookDetails) bool {
+	if !containsFold(book.Author, q.Author) || !containsFold(book.Title, q.Title) {
+		return false
+	}
+	return q.Available == nil || (book.AvailableUnits > 0) == *q.Available
+}
+
+// ordered reports whether the query sorts or reverses the books
+func (q BookQuery) ordered() bool {
+	return q.SortBy != "" || q.Reverse
+}
+
+func (q BookQuery) sort(books []BookDetails) {
+	var less func(a, b BookDetails) bool
+	switch q.SortBy {
+	case SortByIsbn:
+		less = func(a, b BookDetails) bool { return a.Isbn < b.Isbn }
+	case SortByTitle:
+		less = func(a, b BookDetails) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case SortByAuthor:
+		less = func(a, b BookDetails) bool { return strings.ToLower(a.Author) < strings.ToLower(b.Author) }
+	case SortByUnits:
+		less = func(a, b BookDetails) bool { return a.AvailableUnits < b.AvailableUnits }
+	default:
+		if q.Reverse {
+			for i, j := 0, len(books)-1; i < j; i, j = i+1, j-1 {
+				books[i], books[j] = books[j], books[i]
+			}
+		}
+		return
+	}
+	sort.SliceStable(books, func(i, j int) bool {
+		if q.Reverse {
+			return less(books[j], books[i])
+		}
+		return less(books[i], books[j])
+	})
+}
+
+func (q UserQuery) params() url.Values {
+	params := url.Values{}
+	if q.EmailContains != "" {
+		params.Set("email", q.EmailContains)
+	}
+	if q.HasLoans != nil {
+		params.Set("has_loans", strconv.FormatBool(*q.HasLoans))
+	}
+	return params
+}
+
+// Apply filters the users on the client
+func (q UserQuery) Apply(users []User) []User {
+	selected := []User{}
+	for _, user := range users {
+		if !containsFold(user.Email, q.EmailContains) {
+			continue
+		}
+		if q.HasLoans != nil && (len(user.TakenBooks) > 0) != *q.HasLoans {
+			continue
+		}
+		selected = append(selected, user)
+	}
+	return selected
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// supportedParams asks the library REST API which query parameters the collection supports.
+// A server which does not advertise them supports none.
+func supportedParams(ctx context.Context, h HTTPClient, api *Endpoint, token, resource string) map[string]bool {
+	ctx = WithToken(ctx, token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, api.url(resource), nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := h.Do(ctx, req)
+	if err != nil {
+		return nil
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil
+	}
+
+	supported := map[string]bool{}
+	for _, value := range resp.Header.Values(QueryParamsHeader) {
+		for _, param := range strings.Split(value, ",") {
+			if param = strings.TrimSpace(param); param != "" {
+				supported[strings.ToLower(param)] = true
+			}
+		}
+	}
+	return supported
+}
+
+// serverParams returns the parameters the server supports, paging only when it supports all of them
+// together with the filters, as pages of a list the server did not filter would be wrong
+func serverParams(supported map[string]bool, filters, paging url.Values) (url.Values, bool) {
+	params := url.Values{}
+	all := true
+	for key, values := range filters {
+		if supported[key] {
+			params[key] = values
+		} else {
+			all = false
+		}
+	}
+	if len(paging) == 0 {
+		return params, false
+	}
+	for key := range paging {
+		all = all && supported[key]
+	}
+	if !all {
+		return params, false
+	}
+	for key, values := range paging {
+		params[key] = values
+	}
+	return params, true
+}
+
+func withQuery(rawURL string, params url.Values) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+	return fmt.Sprintf("%s?%s", rawURL, params.Encode())
+}
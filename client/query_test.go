@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var queryTestBooks = []BookDetails{
+	{Isbn: "3", Title: "Pod igoto", Author: "Ivan Vazov", AvailableUnits: 2},
+	{Isbn: "1", Title: "Bai Ganyo", Author: "Aleko Konstantinov", AvailableUnits: 0},
+	{Isbn: "2", Title: "Nemili-nedragi", Author: "Ivan Vazov", AvailableUnits: 5},
+}
+
+func isbns(books []BookDetails) []string {
+	result := []string{}
+	for _, book := range books {
+		result = append(result, book.Isbn)
+	}
+	return result
+}
+
+func Test_BookQueryApply(t *testing.T) {
+	available, outOfStock := true, false
+	tests := []struct {
+		name     string
+		query    BookQuery
+		expected []string
+	}{
+		{name: "no query keeps the order", query: BookQuery{}, expected: []string{"3", "1", "2"}},
+		{name: "author", query: BookQuery{Author: "vazov"}, expected: []string{"3", "2"}},
+		{name: "title", query: BookQuery{Title: "GANYO"}, expected: []string{"1"}},
+		{name: "available", query: BookQuery{Available: &available}, expected: []string{"3", "2"}},
+		{name: "out of stock", query: BookQuery{Available: &outOfStock}, expected: []string{"1"}},
+		{name: "sort by isbn", query: BookQuery{SortBy: SortByIsbn}, expected: []string{"1", "2", "3"}},
+		{name: "sort by title", query: BookQuery{SortBy: SortByTitle}, expected: []string{"1", "2", "3"}},
+		{name: "sort by units reversed", query: BookQuery{SortBy: SortByUnits, Reverse: true}, expected: []string{"2", "3", "1"}},
+		{name: "reverse without sort", query: BookQuery{Reverse: true}, expected: []string{"2", "1", "3"}},
+		{name: "limit and offset", query: BookQuery{SortBy: SortByIsbn, Offset: 1, Limit: 1}, expected: []string{"2"}},
+		{name: "offset after the end", query: BookQuery{Offset: 5}, expected: []string{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			books := append([]BookDetails{}, queryTestBooks...)
+			assert.Equal(t, tt.expected, isbns(tt.query.Apply(books)))
+		})
+	}
+}
+
+func Test_UserQueryApply(t *testing.T) {
+	hasLoans := true
+	users := []User{
+		{Email: "misho@gmail.com", TakenBooks: []BookDetails{{Isbn: "1"}}},
+		{Email: "ivan@abv.bg"},
+	}
+	assert.Equal(t, users[:1], UserQuery{EmailContains: "GMAIL"}.Apply(users))
+	assert.Equal(t, users[:1], UserQuery{HasLoans: &hasLoans}.Apply(users))
+	assert.Equal(t, users, UserQuery{}.Apply(users))
+}
+
+func Test_SearchBooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		advertised    string
+		query         BookQuery
+		expectedQuery string
+		expected      []string
+	}{
+		{name: "no query skips the OPTIONS request", query: BookQuery{}, expectedQuery: "", expected: []string{"3", "1", "2"}},
+		{name: "nothing advertised", query: BookQuery{Author: "vazov", Limit: 1}, expectedQuery: "", expected: []string{"3"}},
+		{name: "only filters advertised", advertised: "author", query: BookQuery{Author: "vazov", Limit: 1}, expectedQuery: "author=vazov", expected: []string{"3"}},
+		{
+			name:          "everything advertised",
+			advertised:    "author, sort, order, limit, offset",
+			query:         BookQuery{Author: "vazov", SortBy: SortByIsbn, Reverse: true, Limit: 1, Offset: 1},
+			expectedQuery: "author=vazov&limit=1&offset=1&order=desc&sort=isbn",
+			// the server paged already, so the client does not page again
+			expected: []string{"3", "2"},
+		},
+		{
+			name:          "reverse without sort",
+			advertised:    "order, limit",
+			query:         BookQuery{Reverse: true, Limit: 2},
+			expectedQuery: "limit=2&order=desc",
+			expected:      []string{"3", "1", "2"},
+		},
+		{
+			// a server which can not reverse leaves the order and the pages to the client
+			name:          "reverse without sort and without order advertised",
+			advertised:    "limit",
+			query:         BookQuery{Reverse: true, Limit: 2},
+			expectedQuery: "",
+			expected:      []string{"2", "1"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			options := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodOptions {
+					options++
+					if tt.advertised != "" {
+						w.Header().Set(QueryParamsHeader, tt.advertised)
+					}
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				query = r.URL.RawQuery
+				// a server which ignores the parameters
+				w.Write([]byte(`[{"isbn":"3","author":"Ivan Vazov"},{"isbn":"1","author":"Aleko Konstantinov"},{"isbn":"2","author":"Ivan Vazov"}]`))
+			}))
+			defer server.Close()
+			b := &bookClient{client: NewHTTPClient(), api: &Endpoint{BaseURL: server.URL, APIVersion: "v1"}}
+
+			books, err := b.SearchBooks(context.Background(), "token", tt.query)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedQuery, query)
+			assert.Equal(t, tt.expected, isbns(books))
+			assert.Equal(t, tt.query != BookQuery{}, options == 1)
+		})
+	}
+}
+
+func Test_StreamBooks(t *testing.T) {
+	available := true
+	tests := []struct {
+		name       string
+		advertised string
+		body       string
+		query      BookQuery
+		expected   []string
+		err        string
+	}{
+		{name: "array", body: `[{"isbn":"3","units":2},{"isbn":"1"},{"isbn":"2","availableUnits":5}]`, expected: []string{"3", "1", "2"}},
+		{name: "wrapped", body: `{"total":3,"books":[{"isbn":"3"},{"isbn":"1"},{"isbn":"2"}],"next":null}`, expected: []string{"3", "1", "2"}},
+		{name: "null", body: `null`, expected: []string{}},
+		{name: "filtered and paged", body: `[{"isbn":"3","availableUnits":2},{"isbn":"1"},{"isbn":"2","availableUnits":5},{"isbn":"4","availableUnits":1}]`,
+			query: BookQuery{Available: &available, Offset: 1, Limit: 1}, expected: []string{"2"}},
+		{name: "sorted on the client", body: `[{"isbn":"3"},{"isbn":"1"},{"isbn":"2"}]`, query: BookQuery{SortBy: SortByIsbn, Limit: 2}, expected: []string{"1", "2"}},
+		{name: "sorted by the server", advertised: "sort, order", body: `[{"isbn":"3"},{"isbn":"1"}]`,
+			query: BookQuery{SortBy: SortByIsbn, Reverse: true}, expected: []string{"3", "1"}},
+		{name: "object without books", body: `{"error":"none"}`, expected: []string{}, err: "unable to decode books: expected a list but got an object"},
+		{name: "truncated", body: `[{"isbn":"3"},{"isbn":`, expected: []string{"3"}, err: "unable to decode books: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodOptions {
+					w.Header().Set(QueryParamsHeader, tt.advertised)
+					return
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			b := &bookClient{client: NewHTTPClient(), api: &Endpoint{BaseURL: server.URL, APIVersion: "v1"}}
+
+			streamed := []string{}
+			err := b.StreamBooks(context.Background(), "token", tt.query, func(book BookDetails) error {
+				streamed = append(streamed, book.Isbn)
+				return nil
+			})
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tt.expected, streamed)
+		})
+	}
+}
+
+func Test_StreamBooks_Errors(t *testing.T) {
+	down := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, `{"error":"database is down"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"isbn":"3"},{"isbn":"1"}]`))
+	}))
+	defer server.Close()
+	b := &bookClient{client: NewHTTPClient(WithMaxAttempts(1)), api: &Endpoint{BaseURL: server.URL, APIVersion: "v1"}}
+
+	stop := errors.New("disk full")
+	calls := 0
+	err := b.StreamBooks(context.Background(), "token", BookQuery{}, func(book BookDetails) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+
+	down = true
+	err = b.StreamBooks(context.Background(), "token", BookQuery{}, func(book BookDetails) error { return nil })
+	assert.True(t, errors.Is(err, ErrServer))
+}
+
+func Test_SearchUsers(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set(QueryParamsHeader, "email,has_loans")
+			return
+		}
+		query = r.URL.RawQuery
+		w.Write([]byte(`[{"email":"misho@gmail.com","takenBooks":[{"isbn":"1"}]}]`))
+	}))
+	defer server.Close()
+	u := &userClient{client: NewHTTPClient(), api: &Endpoint{BaseURL: server.URL, APIVersion: "v1"}}
+
+	hasLoans := true
+	users, err := u.SearchUsers(context.Background(), "token", UserQuery{EmailContains: "misho", HasLoans: &hasLoans})
+	assert.Nil(t, err)
+	assert.Equal(t, "email=misho&has_loans=true", query)
+	assert.Len(t, users, 1)
+}
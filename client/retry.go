@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// IdempotencyKeyHeader marks a request which the server executes only once,
+// so it is safe to retry even when the method is not idempotent
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy controls how failed requests are retried.
+//
+// Connection errors and the status codes 429, 502, 503 and 504 are retried with exponential backoff
+// and jitter, waiting for Retry-After when the server sends it. Requests with idempotent methods
+// are retried automatically, other requests only when they carry an Idempotency-Key header.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is sent at most, 1 or less disables retries
+	MaxAttempts int
+	// BaseDelay is the longest wait before the first retry, it doubles on every retry
+	BaseDelay time.Duration
+	// MaxDelay limits the wait between two attempts, a Retry-After longer than it ends the retries
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used by HTTP and NewHTTPClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context which makes the requests sent with it carry the Idempotency-Key header
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+func idempotencyKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// retryable reports whether the request may be sent again
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodPut:
+	default:
+		if req.Header.Get(IdempotencyKeyHeader) == "" {
+			return false
+		}
+	}
+	// the body has to be sent again
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func retryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isConnectionError reports whether the request failed because the connection broke
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	// the server aborted the TLS handshake, e.g. because of the client certificate, and would do it again
+	return opErr.Op != "remote error"
+}
+
+// backoff returns how long to wait before the given retry, starting with 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	limit := p.BaseDelay << uint(retry-1)
+	if limit <= 0 || limit > p.MaxDelay {
+		limit = p.MaxDelay
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(jitter.Int63n(int64(limit) + 1))
+}
+
+// retryAfter parses the Retry-After header which holds either seconds or an http date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// discard drains and closes the body of a response which will not be used
+// so that its connection can be reused
+func discard(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	io.CopyN(ioutil.Discard, resp.Body, 4096)
+	resp.Body.Close()
+}
+
+// jitter is a random source which is safe to use from many goroutines
+var jitter = &lockedSource{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+type lockedSource struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (s *lockedSource) Int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Int63n(n)
+}
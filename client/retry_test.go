@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func Test_HTTPClient_Retry(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		idempotencyKey   string
+		statuses         []int
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{name: "get is retried until it succeeds", method: "GET", statuses: []int{503, 502, 200}, expectedStatus: 200, expectedAttempts: 3},
+		{name: "delete is retried on too many requests", method: "DELETE", statuses: []int{429, 204}, expectedStatus: 204, expectedAttempts: 2},
+		{name: "get gives up after max attempts", method: "GET", statuses: []int{504, 504, 504, 504}, expectedStatus: 504, expectedAttempts: 3},
+		{name: "internal server error is not retried", method: "GET", statuses: []int{500, 200}, expectedStatus: 500, expectedAttempts: 1},
+		{name: "post without idempotency key is not retried", method: "POST", statuses: []int{503, 200}, expectedStatus: 503, expectedAttempts: 1},
+		{name: "post with idempotency key is retried", method: "POST", idempotencyKey: "take-123", statuses: []int{503, 200}, expectedStatus: 200, expectedAttempts: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+				body, _ := ioutil.ReadAll(r.Body)
+				if tt.method == "POST" {
+					assert.Equal(t, `{"isbn":"123"}`, string(body))
+				}
+				assert.Equal(t, tt.idempotencyKey, r.Header.Get(IdempotencyKeyHeader))
+				w.WriteHeader(tt.statuses[attempt-1])
+			}))
+			defer server.Close()
+			h := NewHTTPClient(WithRetryPolicy(testRetryPolicy))
+
+			ctx := context.Background()
+			if tt.idempotencyKey != "" {
+				ctx = WithIdempotencyKey(ctx, tt.idempotencyKey)
+			}
+			req, _ := http.NewRequest(tt.method, server.URL+"/books", bytes.NewBufferString(`{"isbn":"123"}`))
+			resp, err := h.Do(ctx, req)
+			assert.Nil(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tt.expectedAttempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func Test_HTTPClient_RetryConnectionError(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			// drop the connection without an answer
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	h := NewHTTPClient(WithRetryPolicy(testRetryPolicy))
+
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	body, err := h.SendRequest(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "[]", body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func Test_HTTPClient_RetryAfter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	policy := testRetryPolicy
+	policy.MaxDelay = 2 * time.Second
+	h := NewHTTPClient(WithRetryPolicy(policy))
+
+	start := time.Now()
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	_, err := h.SendRequest(context.Background(), req)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= time.Second)
+
+	// the wait is cut short by the context
+	atomic.StoreInt32(&attempts, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequest("GET", server.URL+"/books", nil)
+	_, err = h.SendRequest(ctx, req)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_HTTPClient_RetryAfterLongerThanMaxDelay(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	h := NewHTTPClient(WithRetryPolicy(testRetryPolicy))
+
+	start := time.Now()
+	req, _ := http.NewRequest("GET", server.URL+"/books", nil)
+	resp, err := h.Do(context.Background(), req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func Test_RetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "seconds", value: "3", expected: 3 * time.Second, ok: true},
+		{name: "http date", value: "Fri, 01 Jan 2021 12:00:10 GMT", expected: 10 * time.Second, ok: true},
+		{name: "http date in the past", value: "Fri, 01 Jan 2021 11:00:00 GMT", expected: 0, ok: true},
+		{name: "missing", value: "", expected: 0, ok: false},
+		{name: "invalid", value: "soon", expected: 0, ok: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			d, ok := retryAfter(resp, now)
+			assert.Equal(t, tt.expected, d)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func Test_RetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry := 1; retry <= 10; retry++ {
+		d := p.backoff(retry)
+		assert.True(t, d >= 0)
+		assert.True(t, d <= time.Second)
+		if retry == 1 {
+			assert.True(t, d <= 100*time.Millisecond)
+		}
+	}
+}
+
+func Test_IsConnectionError(t *testing.T) {
+	assert.True(t, isConnectionError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.False(t, isConnectionError(context.Canceled))
+	assert.False(t, isConnectionError(errors.New("unsupported protocol scheme")))
+	assert.False(t, isConnectionError(&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}))
+}
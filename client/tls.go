@@ -0,0 +1,132 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// pinPrefix starts the SPKI pins, the rest is the base64 encoded SHA-256 hash of the public key
+const pinPrefix = "sha256/"
+
+// tlsVersions are the values accepted by TLSConfig.MinVersion
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig holds the settings of the https connections to the library REST API
+type TLSConfig struct {
+	// CAFile is a PEM bundle with the certificate authorities to trust instead of the system ones
+	CAFile string
+	// CertFile and KeyFile hold the client certificate and its key in PEM for mutual TLS
+	CertFile string
+	KeyFile  string
+	// MinVersion is the oldest TLS version to accept, one of 1.0, 1.1, 1.2 and 1.3
+	MinVersion string
+	// Pins are SPKI pins like "sha256/<base64 hash>", one of them has to match
+	// a certificate the server sends when there are any
+	Pins []string
+	// InsecureSkipVerify accepts any certificate, the pins are still checked
+	InsecureSkipVerify bool
+}
+
+// Empty reports whether the default TLS settings are enough
+func (c TLSConfig) Empty() bool {
+	return c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && c.MinVersion == "" &&
+		len(c.Pins) == 0 && !c.InsecureSkipVerify
+}
+
+// Build returns the *tls.Config described by the settings
+func (c TLSConfig) Build() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA bundle: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in the CA bundle %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("the client certificate and its key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version %q, valid versions are 1.0, 1.1, 1.2 and 1.3", c.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if len(c.Pins) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range c.Pins {
+			if err := ValidatePin(pin); err != nil {
+				return nil, err
+			}
+			pins[pin] = true
+		}
+		config.VerifyConnection = verifyPins(pins)
+	}
+	return config, nil
+}
+
+// ValidatePin checks that pin looks like "sha256/<base64 hash>"
+func ValidatePin(pin string) error {
+	if !strings.HasPrefix(pin, pinPrefix) {
+		return fmt.Errorf("invalid pin %q, pins look like %s<base64 hash>", pin, pinPrefix)
+	}
+	hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, pinPrefix))
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("invalid pin %q, it must hold a base64 encoded SHA-256 hash", pin)
+	}
+	return nil
+}
+
+// SPKIPin returns the pin of the public key of the certificate
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// verifyPins accepts a connection when any certificate of the server matches a pin
+func verifyPins(pins map[string]bool) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		for _, cert := range state.PeerCertificates {
+			if pins[SPKIPin(cert)] {
+				return nil
+			}
+		}
+		return errors.New("certificate pinning failed: no certificate of the server matches the pinned public keys")
+	}
+}
+
+// WithTLSConfig sets the TLS settings of the https connections.
+// It replaces a transport set with WithTransport unless that is an *http.Transport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(h *httpClient) {
+		transport := h.httpTransport()
+		transport.TLSClientConfig = config
+		h.transport = transport
+	}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", server.Certificate().Raw)
+	pin := SPKIPin(server.Certificate())
+
+	tests := []struct {
+		name     string
+		settings TLSConfig
+		err      string
+	}{
+		{name: "unknown authority", err: "certificate signed by unknown authority"},
+		{name: "CA bundle", settings: TLSConfig{CAFile: caFile}},
+		{name: "insecure", settings: TLSConfig{InsecureSkipVerify: true}},
+		{name: "matching pin", settings: TLSConfig{CAFile: caFile, Pins: []string{pin}}},
+		{name: "pin with an insecure connection", settings: TLSConfig{InsecureSkipVerify: true, Pins: []string{pin}}},
+		{
+			name:     "other pin",
+			settings: TLSConfig{InsecureSkipVerify: true, Pins: []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}},
+			err:      "certificate pinning failed",
+		},
+		{name: "minimum version", settings: TLSConfig{CAFile: caFile, MinVersion: "1.3"}, err: "protocol version"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.settings.Build()
+			assert.Nil(t, err)
+			err = get(NewHTTPClient(WithTLSConfig(config)), server.URL)
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func Test_TLSConfig_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := newClientCertificate(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", server.Certificate().Raw)
+
+	config, err := TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, get(NewHTTPClient(WithTLSConfig(config)), server.URL))
+
+	config, err = TLSConfig{CAFile: caFile}.Build()
+	assert.Nil(t, err)
+	assert.NotNil(t, get(NewHTTPClient(WithTLSConfig(config)), server.URL))
+}
+
+func Test_TLSConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	assert.Nil(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	tests := []struct {
+		name     string
+		settings TLSConfig
+		err      string
+	}{
+		{name: "missing CA bundle", settings: TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, err: "unable to read the CA bundle"},
+		{name: "empty CA bundle", settings: TLSConfig{CAFile: notPEM}, err: "no certificates found in the CA bundle " + notPEM},
+		{name: "certificate without key", settings: TLSConfig{CertFile: notPEM}, err: "the client certificate and its key must be set together"},
+		{name: "invalid certificate", settings: TLSConfig{CertFile: notPEM, KeyFile: notPEM}, err: "unable to load the client certificate"},
+		{name: "unknown version", settings: TLSConfig{MinVersion: "1.4"}, err: `unsupported minimum TLS version "1.4"`},
+		{name: "invalid pin", settings: TLSConfig{Pins: []string{"md5/abc"}}, err: `invalid pin "md5/abc"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.settings.Build()
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func get(h HTTPClient, url string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	_, err = h.SendRequest(context.Background(), req)
+	return err
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCertificate writes a self-signed client certificate and its key to dir
+func newClientCertificate(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "library-cli"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = writePEM(t, filepath.Join(dir, "client.pem"), "CERTIFICATE", der)
+	keyFile = writePEM(t, filepath.Join(dir, "client-key.pem"), "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile, cert
+}
@@ -2,26 +2,39 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 // UserClient is an interface with methods which will call the library REST API
 //
 // we can use this interface to mock out unit testing calls
 type UserClient interface {
-	Login(username, password string) (string, error)
-	Logout(token string) (string, error)
-	TakeBook(token, email, isbn string) (string, error)
-	ReturnBook(token, email, isbn string) error
-	GetAllUsers(token string) (string, error)
-	GetUser(token, email string) (string, error)
-	Register(email, password string) (string, error)
+	Login(ctx context.Context, username, password string) (string, error)
+	Logout(ctx context.Context, token string) (string, error)
+	TakeBook(ctx context.Context, token, email, isbn string) (string, error)
+	ReturnBook(ctx context.Context, token, email, isbn string) error
+	GetAllUsers(ctx context.Context, token string) (string, error)
+	GetUser(ctx context.Context, token, email string) (string, error)
+	Register(ctx context.Context, email, password string) (string, error)
+
+	// Authenticate is Login with the token extracted from the response
+	Authenticate(ctx context.Context, email, password string) (*LoginResult, error)
+	// ListUsers is GetAllUsers with the response decoded
+	ListUsers(ctx context.Context, token string) ([]User, error)
+	// FindUser is GetUser with the response decoded
+	FindUser(ctx context.Context, token, email string) (*User, error)
+	// SearchUsers is ListUsers with the users filtered by the query
+	SearchUsers(ctx context.Context, token string, query UserQuery) ([]User, error)
 }
 
 type userClient struct {
 	client HTTPClient
+	api    *Endpoint
 }
 
 // UserDetails holds email and password so we can parse it to json
@@ -30,15 +43,101 @@ type UserDetails struct {
 	Password string `json:"password"`
 }
 
+// User is a user of the library with the books the user has taken
+type User struct {
+	Email      string        `json:"Email"`
+	Role       string        `json:"Role"`
+	TakenBooks []BookDetails `json:"TakenBooks"`
+
+	// Extra holds the fields returned by the library REST API which are not known to the cli
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON accepts the field names in any case and keeps the unknown fields in Extra
+func (u *User) UnmarshalJSON(data []byte) error {
+	var user User
+	extra, err := decodeFields(data, map[string]interface{}{
+		"email":         &user.Email,
+		"role":          &user.Role,
+		"takenbooks":    &user.TakenBooks,
+		"borrowedbooks": &user.TakenBooks,
+		"books":         &user.TakenBooks,
+	})
+	if err != nil {
+		return err
+	}
+	user.Extra = extra
+	*u = user
+	return nil
+}
+
+// MarshalJSON encodes the known fields in PascalCase followed by the fields in Extra
+func (u User) MarshalJSON() ([]byte, error) {
+	takenBooks := u.TakenBooks
+	if takenBooks == nil {
+		takenBooks = []BookDetails{}
+	}
+	return encodeFields([]field{
+		{"Email", u.Email},
+		{"Role", u.Role},
+		{"TakenBooks", takenBooks},
+	}, u.Extra)
+}
+
+// LoginResult is the response of the login route
+type LoginResult struct {
+	Token string
+
+	// Extra holds the other fields of the response when it is a json object
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// ErrNoToken is returned when the login response does not contain a token
+var ErrNoToken = errors.New("login response does not contain a token")
+
+// ParseLoginResult extracts the jwt token from the body returned by the login route.
+// The body can be a json object with the token in one of the usual fields,
+// a json string or the bare token.
+func ParseLoginResult(body string) (*LoginResult, error) {
+	body = strings.TrimSpace(body)
+
+	if strings.HasPrefix(body, "{") {
+		result := &LoginResult{}
+		extra, err := decodeFields([]byte(body), map[string]interface{}{
+			"token":       &result.Token,
+			"accesstoken": &result.Token,
+			"jwt":         &result.Token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if result.Token == "" {
+			return nil, ErrNoToken
+		}
+		result.Extra = extra
+		return result, nil
+	}
+
+	var token string
+	if err := json.Unmarshal([]byte(body), &token); err != nil {
+		token = body
+	}
+	if token == "" || strings.ContainsAny(token, " \t\n") {
+		return nil, ErrNoToken
+	}
+	return &LoginResult{Token: token}, nil
+}
+
 // UnauthorizedErr is the error when the http call is unauthorized
 var UnauthorizedErr = errors.New("Unauthorized")
 
-// User is user client which can be used for mocking
-var User UserClient = &userClient{
+// Users is user client which can be used for mocking
+var Users UserClient = &userClient{
 	client: HTTP,
+	api:    API,
 }
 
-func (u userClient) Login(email, password string) (string, error) {
+func (u userClient) Login(ctx context.Context, email, password string) (string, error) {
 	user := &UserDetails{
 		Email:    email,
 		Password: password,
@@ -47,78 +146,79 @@ func (u userClient) Login(email, password string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	req, _ := http.NewRequest("POST", host+port+libraryApiV1+"login", bytes.NewBuffer(jsonData))
+	req, _ := http.NewRequestWithContext(ctx, "POST", u.api.url("login"), bytes.NewBuffer(jsonData))
 
-	respString, err := u.client.SendRequest(req)
+	respString, err := u.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (u userClient) Logout(token string) (string, error) {
-	req, _ := http.NewRequest("POST", host+port+libraryApiV1+"logout", nil)
-	setAuthHeader(token, req)
+func (u userClient) Logout(ctx context.Context, token string) (string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "POST", u.api.url("logout"), nil)
 
-	respString, err := u.client.SendRequest(req)
+	respString, err := u.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (u userClient) TakeBook(token, email, isbn string) (string, error) {
-	req, _ := http.NewRequest("POST", host+port+libraryApiV1+"users/"+email+"/"+isbn, nil)
-	setAuthHeader(token, req)
+func (u userClient) TakeBook(ctx context.Context, token, email, isbn string) (string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "POST", u.api.url("users", email, isbn), nil)
 
-	respString, err := u.client.SendRequest(req)
+	respString, err := u.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (u userClient) ReturnBook(token, email, isbn string) error {
-	req, _ := http.NewRequest("DELETE", host+port+libraryApiV1+"users/"+email+"/"+isbn, nil)
-	setAuthHeader(token, req)
+func (u userClient) ReturnBook(ctx context.Context, token, email, isbn string) error {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "DELETE", u.api.url("users", email, isbn), nil)
 
-	resp, err := u.client.Do(req)
+	resp, err := u.client.Do(ctx, req)
 	if err != nil {
 		return err
 	}
-
-	if resp.StatusCode == http.StatusUnauthorized {
-		return UnauthorizedErr
-	} else if resp.StatusCode != http.StatusNoContent {
-		return errors.New("Unable to return book")
+	if resp.Body != nil {
+		defer resp.Body.Close()
 	}
 
-	return nil
+	return checkResponse(req, resp)
+}
+
+func (u userClient) GetAllUsers(ctx context.Context, token string) (string, error) {
+	return u.getUsers(ctx, token, u.api.url("users"))
 }
 
-func (u userClient) GetAllUsers(token string) (string, error) {
-	req, _ := http.NewRequest("GET", host+port+libraryApiV1+"users", nil)
-	setAuthHeader(token, req)
+func (u userClient) getUsers(ctx context.Context, token, rawURL string) (string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
 
-	respString, err := u.client.SendRequest(req)
+	respString, err := u.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (u userClient) GetUser(token, email string) (string, error) {
-	req, _ := http.NewRequest("GET", host+port+libraryApiV1+"users/"+email, nil)
-	setAuthHeader(token, req)
+func (u userClient) GetUser(ctx context.Context, token, email string) (string, error) {
+	ctx = WithToken(ctx, token)
+	req, _ := http.NewRequestWithContext(ctx, "GET", u.api.url("users", email), nil)
 
-	respString, err := u.client.SendRequest(req)
+	respString, err := u.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
 
-func (u userClient) Register(email, password string) (string, error) {
+func (u userClient) Register(ctx context.Context, email, password string) (string, error) {
 	user := &UserDetails{
 		Email:    email,
 		Password: password,
@@ -127,11 +227,63 @@ func (u userClient) Register(email, password string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	req, _ := http.NewRequest("POST", host+port+libraryApiV1+"register", bytes.NewBuffer(jsonData))
+	req, _ := http.NewRequestWithContext(ctx, "POST", u.api.url("register"), bytes.NewBuffer(jsonData))
 
-	respString, err := u.client.SendRequest(req)
+	respString, err := u.client.SendRequest(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	return respString, nil
 }
+
+func (u userClient) Authenticate(ctx context.Context, email, password string) (*LoginResult, error) {
+	respString, err := u.Login(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLoginResult(respString)
+}
+
+func (u userClient) ListUsers(ctx context.Context, token string) ([]User, error) {
+	return u.listUsers(ctx, token, u.api.url("users"))
+}
+
+func (u userClient) listUsers(ctx context.Context, token, rawURL string) ([]User, error) {
+	respString, err := u.getUsers(ctx, token, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	if err := decodeList([]byte(respString), &users, "users", "data", "items"); err != nil {
+		return nil, fmt.Errorf("unable to decode users: %v", err)
+	}
+	return users, nil
+}
+
+// SearchUsers sends the filters the library REST API advertises with QueryParamsHeader
+// as query parameters and applies all of them on the client
+func (u userClient) SearchUsers(ctx context.Context, token string, query UserQuery) ([]User, error) {
+	rawURL := u.api.url("users")
+	if filters := query.params(); len(filters) > 0 {
+		params, _ := serverParams(supportedParams(ctx, u.client, u.api, token, "users"), filters, nil)
+		rawURL = withQuery(rawURL, params)
+	}
+
+	users, err := u.listUsers(ctx, token, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(users), nil
+}
+
+func (u userClient) FindUser(ctx context.Context, token, email string) (*User, error) {
+	respString, err := u.GetUser(ctx, token, email)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{}
+	if err := json.Unmarshal([]byte(respString), user); err != nil {
+		return nil, fmt.Errorf("unable to decode user: %v", err)
+	}
+	return user, nil
+}
@@ -1,8 +1,12 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,7 +43,7 @@ func Test_UserClient_GetAllUsers(t *testing.T) {
 			u := &userClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := u.GetAllUsers("test")
+			respStr, err := u.GetAllUsers(context.Background(), "test")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -78,7 +82,7 @@ func Test_UserClient_GetUser(t *testing.T) {
 			u := &userClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := u.GetUser("test", "email")
+			respStr, err := u.GetUser(context.Background(), "test", "email")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -117,7 +121,7 @@ func Test_UserClient_Login(t *testing.T) {
 			u := &userClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := u.Login("email", "password")
+			respStr, err := u.Login(context.Background(), "email", "password")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -156,7 +160,7 @@ func Test_UserClient_Logout(t *testing.T) {
 			u := &userClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := u.Logout("test")
+			respStr, err := u.Logout(context.Background(), "test")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -195,7 +199,7 @@ func Test_UserClient_TakeBook(t *testing.T) {
 			u := &userClient{
 				client: tt.mockHTTPClient(m),
 			}
-			respStr, err := u.TakeBook("test", "email", "isbn")
+			respStr, err := u.TakeBook(context.Background(), "test", "email", "isbn")
 			if err != nil {
 				assert.EqualError(t, err, tt.err.Error())
 			}
@@ -222,14 +226,24 @@ func Test_BookClient_ReturnBook(t *testing.T) {
 			m.On("Do", mock.Anything).Return(&http.Response{StatusCode: 401}, nil)
 			return m
 		},
-		err: errors.New("Unauthorized"),
+		err: UnauthorizedErr,
 	}, {
 		name: "unable to delete book",
 		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
-			m.On("Do", mock.Anything).Return(&http.Response{StatusCode: 500}, nil)
+			m.On("Do", mock.Anything).Return(&http.Response{
+				StatusCode: 500,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":"database is down"}`)),
+			}, nil)
 			return m
 		},
-		err: errors.New("Unable to return book"),
+		err: ErrServer,
+	}, {
+		name: "book not found",
+		mockHTTPClient: func(m *mockHTTPClient) *mockHTTPClient {
+			m.On("Do", mock.Anything).Return(&http.Response{StatusCode: 404}, nil)
+			return m
+		},
+		err: ErrNotFound,
 	}}
 	for _, tt := range tests {
 		tt := tt
@@ -238,12 +252,66 @@ func Test_BookClient_ReturnBook(t *testing.T) {
 			u := &userClient{
 				client: tt.mockHTTPClient(m),
 			}
-			err := u.ReturnBook("test", "email", "isbn")
-			if err != nil {
-				assert.EqualError(t, err, tt.err.Error())
+			err := u.ReturnBook(context.Background(), "test", "email", "isbn")
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err))
 			} else {
 				assert.Nil(t, err)
 			}
 		})
 	}
 }
+
+func Test_UserClient_ListUsers(t *testing.T) {
+	m := &mockHTTPClient{}
+	m.On("SendRequest", mock.Anything).Return(`[{"email":"misho@gmail.com","role":"Admin","taken_books":[{"isbn":"123","title":"Pod igoto"}],"id":1}]`, nil)
+	u := &userClient{client: m}
+
+	users, err := u.ListUsers(context.Background(), "test")
+	assert.Nil(t, err)
+	assert.Equal(t, []User{{
+		Email:      "misho@gmail.com",
+		Role:       "Admin",
+		TakenBooks: []BookDetails{{Isbn: "123", Title: "Pod igoto"}},
+		Extra:      map[string]json.RawMessage{"id": json.RawMessage("1")},
+	}}, users)
+}
+
+func Test_UserClient_FindUser(t *testing.T) {
+	m := &mockHTTPClient{}
+	m.On("SendRequest", mock.Anything).Return(`{"Email":"misho@gmail.com","Role":"User","TakenBooks":null}`, nil)
+	u := &userClient{client: m}
+
+	user, err := u.FindUser(context.Background(), "test", "misho@gmail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, &User{Email: "misho@gmail.com", Role: "User"}, user)
+}
+
+func Test_ParseLoginResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected *LoginResult
+		err      error
+	}{
+		{name: "token field", body: `{"token":"abc.def.ghi"}`, expected: &LoginResult{Token: "abc.def.ghi"}},
+		{
+			name:     "access_token field with other fields",
+			body:     `{"access_token":"abc.def.ghi","expires_in":900}`,
+			expected: &LoginResult{Token: "abc.def.ghi", Extra: map[string]json.RawMessage{"expires_in": json.RawMessage("900")}},
+		},
+		{name: "json string", body: `"abc.def.ghi"`, expected: &LoginResult{Token: "abc.def.ghi"}},
+		{name: "bare token", body: "abc.def.ghi\n", expected: &LoginResult{Token: "abc.def.ghi"}},
+		{name: "object without token", body: `{"error":"wrong password"}`, err: ErrNoToken},
+		{name: "plain text message", body: "wrong password", err: ErrNoToken},
+		{name: "empty body", body: "", err: ErrNoToken},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseLoginResult(tt.body)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
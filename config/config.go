@@ -0,0 +1,371 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mishozz/library-cli/client"
+	"github.com/mishozz/library-cli/emailaddr"
+)
+
+const (
+	// DefaultProfile is the profile used when none is selected
+	DefaultProfile = "default"
+
+	configDir  = "library"
+	configName = "config.json"
+)
+
+// Environment variables which override the config file
+const (
+	EnvConfig     = "LIBRARY_CONFIG"
+	EnvProfile    = "LIBRARY_PROFILE"
+	EnvBaseURL    = "LIBRARY_BASE_URL"
+	EnvAPIVersion = "LIBRARY_API_VERSION"
+	EnvTimeout    = "LIBRARY_TIMEOUT"
+	EnvOutput     = "LIBRARY_OUTPUT"
+	// EnvToken provides the jwt token instead of the session stored by login
+	EnvToken = "LIBRARY_TOKEN"
+	// EnvExpiryWarning sets how long before the token expires the commands start warning
+	EnvExpiryWarning = "LIBRARY_EXPIRY_WARNING"
+	// EnvMaxAttempts sets how many times a failed request is sent at most
+	EnvMaxAttempts = "LIBRARY_MAX_ATTEMPTS"
+	// TLS settings of https base urls
+	EnvCAFile        = "LIBRARY_CA_FILE"
+	EnvClientCert    = "LIBRARY_CLIENT_CERT"
+	EnvClientKey     = "LIBRARY_CLIENT_KEY"
+	EnvMinTLSVersion = "LIBRARY_MIN_TLS_VERSION"
+	EnvPins          = "LIBRARY_PINS"
+	// connection settings
+	EnvProxy   = "LIBRARY_PROXY"
+	EnvNoProxy = "LIBRARY_NO_PROXY"
+	EnvSocket  = "LIBRARY_SOCKET"
+	// EnvEmailCanonicalization overrides the email-canonicalization of the profile
+	EnvEmailCanonicalization = "LIBRARY_EMAIL_CANONICALIZATION"
+)
+
+// Config holds the named profiles stored in the config file
+type Config struct {
+	CurrentProfile string              `json:"current-profile,omitempty"`
+	Profiles       map[string]*Profile `json:"profiles,omitempty"`
+}
+
+// Profile holds the settings used to talk to one library server
+type Profile struct {
+	BaseURL    string   `json:"base-url,omitempty"`
+	APIVersion string   `json:"api-version,omitempty"`
+	Timeout    Duration `json:"timeout,omitempty"`
+	Output     string   `json:"output,omitempty"`
+	// ExpiryWarning is how long before the token expires the commands start warning
+	ExpiryWarning Duration `json:"expiry-warning,omitempty"`
+	// MaxAttempts is how many times a failed request is sent at most, 1 disables retries
+	MaxAttempts int `json:"max-attempts,omitempty"`
+	// CAFile is a PEM bundle with the certificate authorities trusted instead of the system ones
+	CAFile string `json:"ca-file,omitempty"`
+	// ClientCert and ClientKey are PEM files with the client certificate for mutual TLS
+	ClientCert    string `json:"client-cert,omitempty"`
+	ClientKey     string `json:"client-key,omitempty"`
+	MinTLSVersion string `json:"min-tls-version,omitempty"`
+	// Pins are SPKI pins like "sha256/<base64 hash>" of which the server must match one
+	Pins []string `json:"pins,omitempty"`
+	// Proxy is the url of the proxy the requests go through, except the ones to the hosts in NoProxy
+	Proxy   string `json:"proxy,omitempty"`
+	NoProxy string `json:"no-proxy,omitempty"`
+	// Socket is a unix:// url of the socket to connect to instead of the host of the base url
+	Socket string `json:"socket,omitempty"`
+	// EmailCanonicalization lists the rules like "trim,lowercase-domain" applied to --email before it is sent
+	EmailCanonicalization string `json:"email-canonicalization,omitempty"`
+}
+
+// Duration is a time.Duration which is stored as a string like "30s"
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ErrUnknownProfile is returned when the selected profile is not in the config file
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// DefaultPath returns the location of the config file when neither
+// the --config flag nor LIBRARY_CONFIG are set
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDir, configName), nil
+}
+
+// ResolvePath picks the config file location.
+// The flag value wins over LIBRARY_CONFIG which wins over the default path.
+func ResolvePath(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if env := os.Getenv(EnvConfig); env != "" {
+		return env, nil
+	}
+	return DefaultPath()
+}
+
+// Load reads the config file. A missing file results in an empty config.
+func Load(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]*Profile{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+// Save writes the config file, creating its directory if needed
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// ProfileNames returns the names of all profiles in alphabetical order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectedProfile returns the name of the profile to use.
+// The flag value wins over LIBRARY_PROFILE which wins over current-profile.
+func (c *Config) SelectedProfile(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv(EnvProfile); env != "" {
+		return env
+	}
+	if c.CurrentProfile != "" {
+		return c.CurrentProfile
+	}
+	return DefaultProfile
+}
+
+// Profile returns the named profile as it is stored in the config file, without the LIBRARY_* environment overrides.
+// The default profile does not have to exist in the config file.
+func (c *Config) Profile(name string) (Profile, error) {
+	var profile Profile
+	if p, ok := c.Profiles[name]; ok {
+		profile = *p
+	} else if name != DefaultProfile {
+		return profile, fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	return profile, nil
+}
+
+// Resolve returns the named profile with the LIBRARY_* environment overrides applied.
+// The default profile does not have to exist in the config file.
+func (c *Config) Resolve(name string) (Profile, error) {
+	profile, err := c.Profile(name)
+	if err != nil {
+		return profile, err
+	}
+
+	for key, env := range envOverrides {
+		if value, ok := os.LookupEnv(env); ok && value != "" {
+			if err := profile.Set(key, value); err != nil {
+				return profile, fmt.Errorf("%s: %v", env, err)
+			}
+		}
+	}
+	return profile, nil
+}
+
+var envOverrides = map[string]string{
+	"base-url":        EnvBaseURL,
+	"api-version":     EnvAPIVersion,
+	"timeout":         EnvTimeout,
+	"output":          EnvOutput,
+	"expiry-warning":  EnvExpiryWarning,
+	"max-attempts":    EnvMaxAttempts,
+	"ca-file":         EnvCAFile,
+	"client-cert":     EnvClientCert,
+	"client-key":      EnvClientKey,
+	"min-tls-version": EnvMinTLSVersion,
+	"pins":            EnvPins,
+	"proxy":           EnvProxy,
+	"no-proxy":        EnvNoProxy,
+	"socket":          EnvSocket,
+
+	"email-canonicalization": EnvEmailCanonicalization,
+}
+
+// Keys returns the setting names accepted by Set
+func Keys() []string {
+	keys := make([]string, 0, len(setters))
+	for key := range setters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set changes a single setting of the profile by its name in the config file
+func (p *Profile) Set(key, value string) error {
+	set, ok := setters[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %q, valid settings are: %s", key, strings.Join(Keys(), ", "))
+	}
+	return set(p, value)
+}
+
+var setters = map[string]func(p *Profile, value string) error{
+	"base-url": func(p *Profile, value string) error {
+		if value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return fmt.Errorf("base-url must start with http:// or https://")
+		}
+		p.BaseURL = value
+		return nil
+	},
+	"api-version": func(p *Profile, value string) error {
+		p.APIVersion = value
+		return nil
+	},
+	"timeout": func(p *Profile, value string) error {
+		return setDuration(&p.Timeout, value)
+	},
+	"expiry-warning": func(p *Profile, value string) error {
+		return setDuration(&p.ExpiryWarning, value)
+	},
+	"output": func(p *Profile, value string) error {
+		p.Output = value
+		return nil
+	},
+	"max-attempts": func(p *Profile, value string) error {
+		if value == "" {
+			p.MaxAttempts = 0
+			return nil
+		}
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return fmt.Errorf("max-attempts must be a number greater than 0")
+		}
+		p.MaxAttempts = attempts
+		return nil
+	},
+	"ca-file": func(p *Profile, value string) error {
+		p.CAFile = value
+		return nil
+	},
+	"client-cert": func(p *Profile, value string) error {
+		p.ClientCert = value
+		return nil
+	},
+	"client-key": func(p *Profile, value string) error {
+		p.ClientKey = value
+		return nil
+	},
+	"min-tls-version": func(p *Profile, value string) error {
+		switch value {
+		case "", "1.0", "1.1", "1.2", "1.3":
+			p.MinTLSVersion = value
+			return nil
+		}
+		return fmt.Errorf("min-tls-version must be one of 1.0, 1.1, 1.2 and 1.3")
+	},
+	"pins": func(p *Profile, value string) error {
+		var pins []string
+		for _, pin := range strings.Split(value, ",") {
+			pin = strings.TrimSpace(pin)
+			if pin == "" {
+				continue
+			}
+			if err := client.ValidatePin(pin); err != nil {
+				return err
+			}
+			pins = append(pins, pin)
+		}
+		p.Pins = pins
+		return nil
+	},
+	"proxy": func(p *Profile, value string) error {
+		if value != "" {
+			u, err := url.Parse(value)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+				return fmt.Errorf("proxy must be an url starting with http://, https:// or socks5://")
+			}
+		}
+		p.Proxy = value
+		return nil
+	},
+	"no-proxy": func(p *Profile, value string) error {
+		p.NoProxy = value
+		return nil
+	},
+	"socket": func(p *Profile, value string) error {
+		if value != "" && (!strings.HasPrefix(value, "unix://") || value == "unix://") {
+			return fmt.Errorf("socket must be an url like unix:///run/library.sock")
+		}
+		p.Socket = value
+		return nil
+	},
+	"email-canonicalization": func(p *Profile, value string) error {
+		if _, err := emailaddr.ParseRules(value); err != nil {
+			return err
+		}
+		p.EmailCanonicalization = value
+		return nil
+	},
+}
+
+func setDuration(d *Duration, value string) error {
+	if value == "" {
+		*d = 0
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const credentialsName = "credentials.json"
+
+// Credentials holds the sessions created by login, keyed by profile name
+type Credentials struct {
+	Sessions map[string]*Session `json:"sessions,omitempty"`
+}
+
+// Session is the token of a logged in user
+type Session struct {
+	Email string `json:"email,omitempty"`
+	Token string `json:"token"`
+}
+
+// CredentialsPath returns the location of the credentials file which sits next to the config file
+func CredentialsPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), credentialsName)
+}
+
+// LoadCredentials reads the credentials file. A missing file results in no sessions.
+func LoadCredentials(path string) (*Credentials, error) {
+	creds := &Credentials{Sessions: map[string]*Session{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %v", path, err)
+	}
+	if creds.Sessions == nil {
+		creds.Sessions = map[string]*Session{}
+	}
+	return creds, nil
+}
+
+// Save writes the credentials file so that only the current user can read it.
+// The tokens go to a temporary file which is created with mode 0600 next to the file
+// and renamed to it, so they are never readable by others, not even for a moment.
+func (c *Credentials) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
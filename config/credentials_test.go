@@ -0,0 +1,34 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Credentials(t *testing.T) {
+	path := CredentialsPath(filepath.Join(t.TempDir(), "config.json"))
+
+	creds, err := LoadCredentials(path)
+	assert.Nil(t, err)
+	assert.Empty(t, creds.Sessions)
+
+	// an existing file with loose permissions is tightened on save
+	assert.Nil(t, ioutil.WriteFile(path, []byte("{}"), 0644))
+
+	creds.Sessions["staging"] = &Session{Email: "misho@gmail.com", Token: "abc.def.ghi"}
+	assert.Nil(t, creds.Save(path))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	assert.Len(t, files, 1, "only the credentials file is left")
+
+	loaded, err := LoadCredentials(path)
+	assert.Nil(t, err)
+	assert.Equal(t, creds, loaded)
+}
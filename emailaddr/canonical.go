@@ -0,0 +1,108 @@
+package emailaddr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rules are the canonicalization rules applied by Normalize
+type Rules int
+
+// The canonicalization rules
+const (
+	// Trim drops the white space around the address
+	Trim Rules = 1 << iota
+	// LowercaseDomain lowercases the domain, which is case insensitive
+	LowercaseDomain
+	// Lowercase lowercases the whole address. Most mail servers ignore the case of the local part
+	// but RFC 5321 lets them tell John@example.com and john@example.com apart, so it is not a default.
+	Lowercase
+	// ASCIIDomain converts an internationalized domain to its xn-- form
+	ASCIIDomain
+)
+
+// DefaultRules are used when no rules are configured
+const DefaultRules = Trim | LowercaseDomain
+
+var ruleNames = []struct {
+	name string
+	rule Rules
+}{
+	{name: "trim", rule: Trim},
+	{name: "lowercase-domain", rule: LowercaseDomain},
+	{name: "lowercase", rule: Lowercase},
+	{name: "ascii-domain", rule: ASCIIDomain},
+}
+
+// RuleNames lists the names accepted by ParseRules
+func RuleNames() []string {
+	names := make([]string, 0, len(ruleNames)+1)
+	for _, r := range ruleNames {
+		names = append(names, r.name)
+	}
+	return append(names, "none")
+}
+
+// ParseRules parses a comma separated list of rule names like "trim,lowercase-domain".
+// "none" turns every rule off and an empty list returns the DefaultRules.
+func ParseRules(s string) (Rules, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultRules, nil
+	}
+	var rules Rules
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "none" {
+			continue
+		}
+		found := false
+		for _, r := range ruleNames {
+			if r.name == name {
+				rules |= r.rule
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown email canonicalization %q, valid ones are %s", name, strings.Join(RuleNames(), ", "))
+		}
+	}
+	return rules, nil
+}
+
+// String returns the rule names separated by commas or "none"
+func (r Rules) String() string {
+	var names []string
+	for _, rule := range ruleNames {
+		if r&rule.rule != 0 {
+			names = append(names, rule.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Normalize validates s with Parse after trimming it when the Trim rule is set
+// and returns the address canonicalized with the rules.
+func Normalize(s string, rules Rules) (string, error) {
+	if rules&Trim != 0 {
+		s = strings.TrimSpace(s)
+	}
+	a, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if rules&(Lowercase|LowercaseDomain) != 0 {
+		a.Domain = strings.ToLower(a.Domain)
+	}
+	if rules&Lowercase != 0 {
+		a.Local = strings.ToLower(a.Local)
+	}
+	if rules&ASCIIDomain != 0 {
+		if a.Domain, err = ToASCII(a.Domain); err != nil {
+			return "", invalid(s, err.Error())
+		}
+	}
+	return a.String(), nil
+}
@@ -0,0 +1,178 @@
+// Package emailaddr validates email addresses like the addr-spec of RFC 5322 and canonicalizes them
+package emailaddr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrInvalid is matched by the errors of Parse and Normalize
+var ErrInvalid = errors.New("invalid email")
+
+// Limits of RFC 5321 which mail servers enforce
+const (
+	maxLength      = 254
+	maxLocalLength = 64
+	maxLabelLength = 63
+	maxHostLength  = 253
+)
+
+// atext are the characters besides letters and digits allowed in the dot-atom of the local part
+const atext = "!#$%&'*+-/=?^_`{|}~"
+
+// Address is an email address split at the last @
+type Address struct {
+	Local  string
+	Domain string
+}
+
+// String returns the address as local@domain
+func (a Address) String() string {
+	return a.Local + "@" + a.Domain
+}
+
+// Parse checks that s is an addr-spec: a dot-atom or quoted local part, an @ and a host name,
+// an internationalized domain name or an address literal like [192.0.2.1].
+// Comments, folding white space and the obsolete forms of RFC 5322 are refused.
+func Parse(s string) (Address, error) {
+	at := strings.LastIndex(s, "@")
+	if at < 0 {
+		return Address{}, invalid(s, "it has no @")
+	}
+	a := Address{Local: s[:at], Domain: s[at+1:]}
+
+	if err := checkLocal(a.Local); err != "" {
+		return Address{}, invalid(s, err)
+	}
+	if err := checkDomain(a.Domain); err != "" {
+		return Address{}, invalid(s, err)
+	}
+	if len(s) > maxLength {
+		return Address{}, invalid(s, fmt.Sprintf("it is longer than %d characters", maxLength))
+	}
+	return a, nil
+}
+
+func invalid(s, reason string) error {
+	return fmt.Errorf("%w %q: %s", ErrInvalid, s, reason)
+}
+
+// checkLocal returns why the local part is invalid or "" when it is valid
+func checkLocal(local string) string {
+	switch {
+	case local == "":
+		return "the part before the @ is empty"
+	case len(local) > maxLocalLength:
+		return fmt.Sprintf("the part before the @ is longer than %d characters", maxLocalLength)
+	case strings.HasPrefix(local, `"`):
+		return checkQuoted(local)
+	}
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return "the part before the @ can not start or end with a dot or have two dots in a row"
+		}
+		for _, c := range atom {
+			if !isAlphaNumeric(c) && !strings.ContainsRune(atext, c) {
+				return fmt.Sprintf("%q is not allowed before the @ unless the part is quoted", c)
+			}
+		}
+	}
+	return ""
+}
+
+// checkQuoted checks a quoted local part like "john doe"
+func checkQuoted(local string) string {
+	if len(local) < 2 || !strings.HasSuffix(local, `"`) {
+		return "the quoted part before the @ is not closed"
+	}
+	content := local[1 : len(local)-1]
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\':
+			i++
+			if i == len(content) || content[i] < ' ' || content[i] > '~' {
+				return "a backslash in the quoted part must escape a printable character"
+			}
+		case c == '"':
+			return "a quote in the quoted part must be escaped with a backslash"
+		case c < ' ' || c > '~':
+			return "the quoted part may only hold printable ASCII characters"
+		}
+	}
+	return ""
+}
+
+// checkDomain returns why the domain is invalid or "" when it is valid
+func checkDomain(domain string) string {
+	if domain == "" {
+		return "the domain after the @ is empty"
+	}
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		literal := domain[1 : len(domain)-1]
+		if len(literal) > 5 && strings.EqualFold(literal[:5], "IPv6:") {
+			if ip := net.ParseIP(literal[5:]); ip != nil && ip.To4() == nil {
+				return ""
+			}
+		} else if ip := net.ParseIP(literal); ip != nil && ip.To4() != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s is not an IPv4 or IPv6: address literal", domain)
+	}
+
+	ascii, err := ToASCII(domain)
+	if err != nil {
+		return err.Error()
+	}
+	if len(ascii) > maxHostLength {
+		return fmt.Sprintf("the domain is longer than %d characters", maxHostLength)
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		switch {
+		case label == "":
+			return "the domain can not start or end with a dot or have two dots in a row"
+		case len(label) > maxLabelLength:
+			return fmt.Sprintf("the domain has a part longer than %d characters", maxLabelLength)
+		case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+			return "the parts of the domain can not start or end with a hyphen"
+		}
+		for _, c := range label {
+			if !isAlphaNumeric(c) && c != '-' {
+				return fmt.Sprintf("%q is not allowed in the domain", c)
+			}
+		}
+	}
+	return ""
+}
+
+func isAlphaNumeric(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// ToASCII converts an internationalized domain name like bücher.example to its
+// ASCII form xn--bcher-kva.example. The labels which are ASCII already are kept as they are.
+func ToASCII(domain string) (string, error) {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycode(strings.ToLower(label))
+		if err != nil {
+			return "", err
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package emailaddr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Address
+		err      string
+	}{
+		{name: "simple", input: "john@example.com", expected: Address{Local: "john", Domain: "example.com"}},
+		{name: "plus tag", input: "john+books@example.com", expected: Address{Local: "john+books", Domain: "example.com"}},
+		{name: "dots and atext", input: "j.o'hara!#$%&*/=?^_`{|}~-@example.com", expected: Address{Local: "j.o'hara!#$%&*/=?^_`{|}~-", Domain: "example.com"}},
+		{name: "single label domain", input: "admin@localhost", expected: Address{Local: "admin", Domain: "localhost"}},
+		{name: "quoted", input: `"john doe"@example.com`, expected: Address{Local: `"john doe"`, Domain: "example.com"}},
+		{name: "quoted at", input: `"john@home"@example.com`, expected: Address{Local: `"john@home"`, Domain: "example.com"}},
+		{name: "quoted pair", input: `"john\"doe"@example.com`, expected: Address{Local: `"john\"doe"`, Domain: "example.com"}},
+		{name: "idn", input: "hans@bücher.example", expected: Address{Local: "hans", Domain: "bücher.example"}},
+		{name: "ipv4 literal", input: "john@[192.0.2.1]", expected: Address{Local: "john", Domain: "[192.0.2.1]"}},
+		{name: "ipv6 literal", input: "john@[IPv6:2001:db8::1]", expected: Address{Local: "john", Domain: "[IPv6:2001:db8::1]"}},
+		{name: "no at", input: "john.example.com", err: `invalid email "john.example.com": it has no @`},
+		{name: "empty", input: "", err: `invalid email "": it has no @`},
+		{name: "empty local part", input: "@example.com", err: `invalid email "@example.com": the part before the @ is empty`},
+		{name: "empty domain", input: "john@", err: `invalid email "john@": the domain after the @ is empty`},
+		{name: "leading dot", input: ".john@example.com", err: `invalid email ".john@example.com": the part before the @ can not start or end with a dot or have two dots in a row`},
+		{name: "two dots", input: "john..doe@example.com", err: `invalid email "john..doe@example.com": the part before the @ can not start or end with a dot or have two dots in a row`},
+		{name: "space", input: "john doe@example.com", err: `invalid email "john doe@example.com": ' ' is not allowed before the @ unless the part is quoted`},
+		{name: "white space around", input: " john@example.com", err: `invalid email " john@example.com": ' ' is not allowed before the @ unless the part is quoted`},
+		{name: "two ats", input: "john@doe@example.com", err: `invalid email "john@doe@example.com": '@' is not allowed before the @ unless the part is quoted`},
+		{name: "unicode local part", input: "jöhn@example.com", err: `invalid email "jöhn@example.com": 'ö' is not allowed before the @ unless the part is quoted`},
+		{name: "unclosed quote", input: `"john@example.com`, err: `invalid email "\"john@example.com": the quoted part before the @ is not closed`},
+		{name: "unescaped quote", input: `"jo"hn"@example.com`, err: `invalid email "\"jo\"hn\"@example.com": a quote in the quoted part must be escaped with a backslash`},
+		{name: "domain dot", input: "john@example..com", err: `invalid email "john@example..com": the domain can not start or end with a dot or have two dots in a row`},
+		{name: "domain hyphen", input: "john@-example.com", err: `invalid email "john@-example.com": the parts of the domain can not start or end with a hyphen`},
+		{name: "domain underscore", input: "john@ex_ample.com", err: `invalid email "john@ex_ample.com": '_' is not allowed in the domain`},
+		{name: "domain slash", input: "john@example.com/books", err: `invalid email "john@example.com/books": '/' is not allowed in the domain`},
+		{name: "invalid literal", input: "john@[300.0.0.1]", err: `invalid email "john@[300.0.0.1]": [300.0.0.1] is not an IPv4 or IPv6: address literal`},
+		{name: "long local part", input: strings.Repeat("a", 65) + "@example.com", err: `invalid email "` + strings.Repeat("a", 65) + `@example.com": the part before the @ is longer than 64 characters`},
+		{name: "long label", input: "john@" + strings.Repeat("a", 64) + ".com", err: `invalid email "john@` + strings.Repeat("a", 64) + `.com": the domain has a part longer than 63 characters`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			address, err := Parse(tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.True(t, errors.Is(err, ErrInvalid))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, address)
+			assert.Equal(t, tt.input, address.String())
+		})
+	}
+}
+
+func Test_ToASCII(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "example.com", expected: "example.com"},
+		{input: "bücher.example", expected: "xn--bcher-kva.example"},
+		{input: "München.de", expected: "xn--mnchen-3ya.de"},
+		{input: "例え.テスト", expected: "xn--r8jz45g.xn--zckzah"},
+		{input: "пример.испытание", expected: "xn--e1afmkfd.xn--80akhbyknj4f"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			ascii, err := ToASCII(tt.input)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, ascii)
+		})
+	}
+}
+
+func Test_Normalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		rules    Rules
+		expected string
+		err      string
+	}{
+		{name: "default", input: "  John.Doe+Books@Example.COM\n", rules: DefaultRules, expected: "John.Doe+Books@example.com"},
+		{name: "lowercase", input: "John.Doe+Books@Example.COM", rules: Lowercase, expected: "john.doe+books@example.com"},
+		{name: "none", input: "John@Example.COM", rules: 0, expected: "John@Example.COM"},
+		{name: "none does not trim", input: " john@example.com", rules: 0, err: `invalid email " john@example.com": ' ' is not allowed before the @ unless the part is quoted`},
+		{name: "lowercase domain", input: "John@Example.COM", rules: LowercaseDomain, expected: "John@example.com"},
+		{name: "ascii domain", input: "Hans@Bücher.example", rules: Lowercase | ASCIIDomain, expected: "hans@xn--bcher-kva.example"},
+		{name: "ipv6 literal", input: "john@[IPv6:2001:DB8::1]", rules: Lowercase, expected: "john@[ipv6:2001:db8::1]"},
+		{name: "invalid", input: "john", rules: DefaultRules, err: `invalid email "john": it has no @`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := Normalize(tt.input, tt.rules)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, email)
+
+			_, err = Parse(email)
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func Test_ParseRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Rules
+		err      string
+	}{
+		{input: "", expected: DefaultRules},
+		{input: "none", expected: 0},
+		{input: "trim, lowercase-domain", expected: Trim | LowercaseDomain},
+		{input: "Lowercase,ascii-domain", expected: Lowercase | ASCIIDomain},
+		{input: "upper", err: `unknown email canonicalization "upper", valid ones are trim, lowercase-domain, lowercase, ascii-domain, none`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			rules, err := ParseRules(tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, rules)
+		})
+	}
+	assert.Equal(t, "trim,lowercase-domain", DefaultRules.String())
+	assert.Equal(t, "none", Rules(0).String())
+}
@@ -4,5 +4,6 @@ go 1.15
 
 require (
 	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.3.0
 )
@@ -0,0 +1,114 @@
+// Package isbn parses ISBN-10 and ISBN-13 numbers and converts between them
+package isbn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalid is matched by the errors of Parse
+var ErrInvalid = errors.New("invalid isbn")
+
+// ISBN is an ISBN-10 or ISBN-13 without hyphens and spaces, e.g. "0306406152" or "9780306406157"
+type ISBN string
+
+// Parse checks the digits and the check digit of an ISBN-10 or ISBN-13.
+// Hyphens and spaces are dropped and a lowercase x check digit of an ISBN-10 becomes X.
+func Parse(s string) (ISBN, error) {
+	digits := strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s))
+	digits = strings.ToUpper(digits)
+
+	switch len(digits) {
+	case 10:
+		for i, c := range digits {
+			if (c < '0' || c > '9') && !(c == 'X' && i == 9) {
+				return "", invalid(s, "an ISBN-10 has 9 digits followed by a digit or X")
+			}
+		}
+		if check := checkDigit10(digits[:9]); check != digits[9] {
+			return "", invalid(s, fmt.Sprintf("the check digit should be %c", check))
+		}
+	case 13:
+		for _, c := range digits {
+			if c < '0' || c > '9' {
+				return "", invalid(s, "an ISBN-13 has only digits")
+			}
+		}
+		if !strings.HasPrefix(digits, "978") && !strings.HasPrefix(digits, "979") {
+			return "", invalid(s, "an ISBN-13 starts with 978 or 979")
+		}
+		if check := checkDigit13(digits[:12]); check != digits[12] {
+			return "", invalid(s, fmt.Sprintf("the check digit should be %c", check))
+		}
+	default:
+		return "", invalid(s, "it must have 10 or 13 digits")
+	}
+	return ISBN(digits), nil
+}
+
+func invalid(s, reason string) error {
+	return fmt.Errorf("%w %q: %s", ErrInvalid, s, reason)
+}
+
+// Is10 reports whether the isbn is an ISBN-10
+func (i ISBN) Is10() bool {
+	return len(i) == 10
+}
+
+// Is13 reports whether the isbn is an ISBN-13
+func (i ISBN) Is13() bool {
+	return len(i) == 13
+}
+
+// To13 returns the ISBN-13 of the isbn, an ISBN-13 is returned as it is
+func (i ISBN) To13() ISBN {
+	if !i.Is10() {
+		return i
+	}
+	digits := "978" + string(i[:9])
+	return ISBN(digits + string(checkDigit13(digits)))
+}
+
+// To10 returns the ISBN-10 of the isbn. Only the ISBN-13 starting with 978 have one.
+func (i ISBN) To10() (ISBN, error) {
+	if !i.Is13() {
+		return i, nil
+	}
+	if !strings.HasPrefix(string(i), "978") {
+		return "", fmt.Errorf("%s has no ISBN-10, only the ISBN-13 starting with 978 do", i)
+	}
+	digits := string(i[3:12])
+	return ISBN(digits + string(checkDigit10(digits))), nil
+}
+
+// String returns the isbn without hyphens
+func (i ISBN) String() string {
+	return string(i)
+}
+
+// checkDigit10 returns the check digit of the first 9 digits of an ISBN-10
+func checkDigit10(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(digits[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 returns the check digit of the first 12 digits of an ISBN-13
+func checkDigit13(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(digits[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
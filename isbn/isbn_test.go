@@ -0,0 +1,69 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected ISBN
+		err      string
+	}{
+		{name: "isbn 10", input: "0306406152", expected: "0306406152"},
+		{name: "hyphens and spaces", input: " 0-306-40615-2 ", expected: "0306406152"},
+		{name: "x check digit", input: "0-8044-2957-x", expected: "080442957X"},
+		{name: "isbn 13", input: "978-0-306-40615-7", expected: "9780306406157"},
+		{name: "979 prefix", input: "979-10-90636-07-1", expected: "9791090636071"},
+		{name: "wrong isbn 10 check digit", input: "0306406153", err: `invalid isbn "0306406153": the check digit should be 2`},
+		{name: "wrong isbn 13 check digit", input: "9780306406158", err: `invalid isbn "9780306406158": the check digit should be 7`},
+		{name: "x in the middle", input: "03064X6152", err: `invalid isbn "03064X6152": an ISBN-10 has 9 digits followed by a digit or X`},
+		{name: "letters in isbn 13", input: "978030640615X", err: `invalid isbn "978030640615X": an ISBN-13 has only digits`},
+		{name: "not a bookland prefix", input: "1234567890128", err: `invalid isbn "1234567890128": an ISBN-13 starts with 978 or 979`},
+		{name: "too short", input: "123", err: `invalid isbn "123": it must have 10 or 13 digits`},
+		{name: "slash", input: "03064061/2", err: `invalid isbn "03064061/2": an ISBN-10 has 9 digits followed by a digit or X`},
+		{name: "empty", input: "", err: `invalid isbn "": it must have 10 or 13 digits`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			isbn, err := Parse(tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.True(t, errors.Is(err, ErrInvalid))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, isbn)
+		})
+	}
+}
+
+func Test_Convert(t *testing.T) {
+	tests := []struct {
+		isbn10 ISBN
+		isbn13 ISBN
+	}{
+		{isbn10: "0306406152", isbn13: "9780306406157"},
+		{isbn10: "080442957X", isbn13: "9780804429573"},
+		{isbn10: "0747532699", isbn13: "9780747532699"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.isbn10), func(t *testing.T) {
+			assert.Equal(t, tt.isbn13, tt.isbn10.To13())
+			assert.Equal(t, tt.isbn13, tt.isbn13.To13())
+
+			isbn10, err := tt.isbn13.To10()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.isbn10, isbn10)
+		})
+	}
+
+	_, err := ISBN("9791090636071").To10()
+	assert.EqualError(t, err, "9791090636071 has no ISBN-10, only the ISBN-13 starting with 978 do")
+}
@@ -0,0 +1,572 @@
+// Package jsonpath implements a subset of the JSONPath templates of kubectl for data decoded from json.
+//
+// A template is text with expressions in braces, e.g. "{.[*].Title}" or
+// "{range .[*]}{.Isbn}{\"\\t\"}{.Title}{\"\\n\"}{end}". The supported expressions are
+//
+//	$ or @             the root or the current value
+//	.name ['name']     a field of an object
+//	.* [*]             all items of an array or all values of an object
+//	..name             the field in the value and everything below it
+//	[1] [-1] [1:3]     items of an array by index, counted from the end when negative, or a slice
+//	[?(@.a > 1)]       the items for which the filter holds, comparing with a number or a quoted string
+//	                   by ==, !=, <, <=, > and >=, or [?(@.a)] for the items which have a
+//	range ... end      repeats the template in between for every value
+//	"text"             a quoted string with escapes like "\n"
+//
+// Everything else, like ..*, unions, negative slice bounds, && and || in filters or comparisons
+// with true, false and null, is refused by Parse instead of being evaluated differently than kubectl does.
+//
+// Expressions which result in several values print them separated by spaces.
+// Fields which do not exist result in no values instead of an error.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Template is a parsed JSONPath template
+type Template struct {
+	nodes []node
+}
+
+type node interface{}
+
+type textNode string
+
+type rangeNode struct {
+	path path
+	body []node
+}
+
+// path is a list of segments applied one after the other
+type path struct {
+	root     bool
+	segments []segment
+}
+
+type segmentKind int
+
+const (
+	fieldSegment segmentKind = iota
+	wildcardSegment
+	recursiveSegment
+	indexSegment
+	sliceSegment
+	filterSegment
+)
+
+type segment struct {
+	kind segmentKind
+	// name of a field
+	name string
+	// index or the bounds of a slice, a bound is nil when it is left out
+	index      int
+	start, end *int
+	filter     *filter
+}
+
+type filter struct {
+	left path
+	// op is empty when the filter checks that the left side exists
+	op    string
+	right interface{}
+}
+
+// Parse parses a JSONPath template
+func Parse(text string) (*Template, error) {
+	p := &parser{text: text}
+	nodes, end, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		return nil, fmt.Errorf("jsonpath: {end} without {range}")
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+type parser struct {
+	text string
+	pos  int
+}
+
+// parse returns the nodes up to the end of the text or an {end} action
+func (p *parser) parse() ([]node, bool, error) {
+	var nodes []node
+	for p.pos < len(p.text) {
+		open := strings.IndexByte(p.text[p.pos:], '{')
+		if open < 0 {
+			nodes = append(nodes, textNode(p.text[p.pos:]))
+			p.pos = len(p.text)
+			break
+		}
+		if open > 0 {
+			nodes = append(nodes, textNode(p.text[p.pos:p.pos+open]))
+		}
+		start := p.pos + open + 1
+		close := closing(p.text, start, '{', '}')
+		if close < 0 {
+			return nil, false, fmt.Errorf("jsonpath: unclosed { at %d", start-1)
+		}
+		action := strings.TrimSpace(p.text[start:close])
+		p.pos = close + 1
+
+		switch {
+		case action == "end":
+			return nodes, true, nil
+		case strings.HasPrefix(action, "range "):
+			rangePath, err := parsePath(strings.TrimSpace(strings.TrimPrefix(action, "range ")))
+			if err != nil {
+				return nil, false, err
+			}
+			body, end, err := p.parse()
+			if err != nil {
+				return nil, false, err
+			}
+			if !end {
+				return nil, false, fmt.Errorf("jsonpath: {range} without {end}")
+			}
+			nodes = append(nodes, &rangeNode{path: rangePath, body: body})
+		case strings.HasPrefix(action, `"`):
+			text, err := strconv.Unquote(action)
+			if err != nil {
+				return nil, false, fmt.Errorf("jsonpath: invalid string %s", action)
+			}
+			nodes = append(nodes, textNode(text))
+		default:
+			actionPath, err := parsePath(action)
+			if err != nil {
+				return nil, false, err
+			}
+			nodes = append(nodes, actionPath)
+		}
+	}
+	return nodes, false, nil
+}
+
+// closing returns the position of the bracket which closes the one opened before start,
+// skipping quoted strings and nested brackets
+func closing(text string, start int, open, close byte) int {
+	depth := 1
+	for i := start; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"', '\'':
+			for i++; i < len(text) && text[i] != c; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parsePath(text string) (path, error) {
+	var p path
+	i := 0
+	if strings.HasPrefix(text, "$") {
+		p.root = true
+		i++
+	} else if strings.HasPrefix(text, "@") {
+		i++
+	}
+
+	for i < len(text) {
+		switch {
+		case strings.HasPrefix(text[i:], ".."):
+			i += 2
+			name := readName(text, i)
+			i += len(name)
+			if name == "*" {
+				return p, fmt.Errorf("jsonpath: ..* is not supported in %q, name the field after ..", text)
+			} else if name == "" {
+				return p, fmt.Errorf("jsonpath: missing field name after .. in %q", text)
+			}
+			p.segments = append(p.segments, segment{kind: recursiveSegment, name: name})
+		case text[i] == '.':
+			i++
+			name := readName(text, i)
+			i += len(name)
+			switch name {
+			case "":
+				// "." alone is the current value and ".[" is followed by a bracket
+			case "*":
+				p.segments = append(p.segments, segment{kind: wildcardSegment})
+			default:
+				p.segments = append(p.segments, segment{kind: fieldSegment, name: name})
+			}
+		case text[i] == '[':
+			end := closing(text, i+1, '[', ']')
+			if end < 0 {
+				return p, fmt.Errorf("jsonpath: unclosed [ in %q", text)
+			}
+			s, err := parseBracket(strings.TrimSpace(text[i+1 : end]))
+			if err != nil {
+				return p, err
+			}
+			p.segments = append(p.segments, s)
+			i = end + 1
+		default:
+			return p, fmt.Errorf("jsonpath: unexpected %q in %q", text[i], text)
+		}
+	}
+	return p, nil
+}
+
+func readName(text string, start int) string {
+	end := start
+	for end < len(text) && !strings.ContainsRune(".[]() =!<>", rune(text[end])) {
+		end++
+	}
+	return text[start:end]
+}
+
+func parseBracket(text string) (segment, error) {
+	switch {
+	case text == "*":
+		return segment{kind: wildcardSegment}, nil
+	case strings.HasPrefix(text, "?(") && strings.HasSuffix(text, ")"):
+		f, err := parseFilter(strings.TrimSpace(text[2 : len(text)-1]))
+		return segment{kind: filterSegment, filter: f}, err
+	case strings.HasPrefix(text, "'") || strings.HasPrefix(text, `"`):
+		if indexOutsideQuotes(text, ",") >= 0 {
+			return segment{}, fmt.Errorf("jsonpath: unions like [%s] are not supported", text)
+		}
+		name, err := unquote(text)
+		return segment{kind: fieldSegment, name: name}, err
+	case strings.Contains(text, ","):
+		return segment{}, fmt.Errorf("jsonpath: unions like [%s] are not supported", text)
+	case strings.Contains(text, ":"):
+		bounds := strings.SplitN(text, ":", 2)
+		s := segment{kind: sliceSegment}
+		for i, bound := range bounds {
+			bound = strings.TrimSpace(bound)
+			if bound == "" {
+				continue
+			}
+			n, err := strconv.Atoi(bound)
+			if err != nil {
+				return s, fmt.Errorf("jsonpath: invalid slice [%s]", text)
+			}
+			if n < 0 {
+				return s, fmt.Errorf("jsonpath: negative slice bounds are not supported in [%s]", text)
+			}
+			if i == 0 {
+				s.start = &n
+			} else {
+				s.end = &n
+			}
+		}
+		return s, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return segment{}, fmt.Errorf("jsonpath: invalid index [%s]", text)
+	}
+	return segment{kind: indexSegment, index: n}, nil
+}
+
+func unquote(text string) (string, error) {
+	if strings.HasPrefix(text, "'") && strings.HasSuffix(text, "'") && len(text) >= 2 {
+		return text[1 : len(text)-1], nil
+	}
+	s, err := strconv.Unquote(text)
+	if err != nil {
+		return "", fmt.Errorf("jsonpath: invalid string %s", text)
+	}
+	return s, nil
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseFilter(text string) (*filter, error) {
+	for _, op := range []string{"&&", "||"} {
+		if indexOutsideQuotes(text, op) >= 0 {
+			return nil, fmt.Errorf("jsonpath: %s is not supported in filter %q", op, text)
+		}
+	}
+	f := &filter{}
+	left := text
+	for _, op := range operators {
+		if i := indexOutsideQuotes(text, op); i >= 0 {
+			f.op = op
+			left = strings.TrimSpace(text[:i])
+			right, err := parseLiteral(strings.TrimSpace(text[i+len(op):]))
+			if err != nil {
+				return nil, err
+			}
+			f.right = right
+			break
+		}
+	}
+	if !strings.HasPrefix(left, "@") {
+		return nil, fmt.Errorf("jsonpath: filter %q must start with @", text)
+	}
+	var err error
+	f.left, err = parsePath(left)
+	return f, err
+}
+
+func indexOutsideQuotes(text, s string) int {
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch {
+		case quote != 0:
+			if text[i] == quote {
+				quote = 0
+			}
+		case text[i] == '"' || text[i] == '\'':
+			quote = text[i]
+		case strings.HasPrefix(text[i:], s):
+			return i
+		}
+	}
+	return -1
+}
+
+func parseLiteral(text string) (interface{}, error) {
+	switch text {
+	case "true", "false", "null":
+		return nil, fmt.Errorf("jsonpath: %s is not supported in filters, compare with a number or a quoted string", text)
+	}
+	if strings.HasPrefix(text, "'") || strings.HasPrefix(text, `"`) {
+		return unquote(text)
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("jsonpath: invalid value %s in filter", text)
+	}
+	return n, nil
+}
+
+// Execute writes the template applied to the data, which is a value decoded from json
+// like map[string]interface{}, []interface{}, string, float64, json.Number, bool or nil
+func (t *Template) Execute(w io.Writer, data interface{}) error {
+	var buf bytes.Buffer
+	if err := execute(&buf, t.nodes, data, data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func execute(buf *bytes.Buffer, nodes []node, root, current interface{}) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			buf.WriteString(string(n))
+		case path:
+			values := n.eval(root, current)
+			for i, value := range values {
+				if i > 0 {
+					buf.WriteByte(' ')
+				}
+				if err := printValue(buf, value); err != nil {
+					return err
+				}
+			}
+		case *rangeNode:
+			for _, value := range n.path.eval(root, current) {
+				if err := execute(buf, n.body, root, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func printValue(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		buf.WriteString(v)
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	default:
+		fmt.Fprint(buf, v)
+	}
+	return nil
+}
+
+func (p path) eval(root, current interface{}) []interface{} {
+	values := []interface{}{current}
+	if p.root {
+		values = []interface{}{root}
+	}
+	for _, s := range p.segments {
+		var next []interface{}
+		for _, value := range values {
+			next = append(next, s.apply(root, value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (s segment) apply(root, value interface{}) []interface{} {
+	switch s.kind {
+	case fieldSegment:
+		if m, ok := value.(map[string]interface{}); ok {
+			if v, ok := m[s.name]; ok {
+				return []interface{}{v}
+			}
+		}
+	case wildcardSegment:
+		return children(value)
+	case recursiveSegment:
+		var values []interface{}
+		for _, v := range descendants(value) {
+			if m, ok := v.(map[string]interface{}); ok {
+				if field, ok := m[s.name]; ok {
+					values = append(values, field)
+				}
+			}
+		}
+		return values
+	case indexSegment:
+		if list, ok := value.([]interface{}); ok {
+			i := s.index
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				return []interface{}{list[i]}
+			}
+		}
+	case sliceSegment:
+		if list, ok := value.([]interface{}); ok {
+			start, end := bound(s.start, 0, len(list)), bound(s.end, len(list), len(list))
+			if start < end {
+				return list[start:end]
+			}
+		}
+	case filterSegment:
+		var values []interface{}
+		for _, child := range children(value) {
+			if s.filter.match(root, child) {
+				values = append(values, child)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func bound(b *int, value, length int) int {
+	if b != nil {
+		value = *b
+	}
+	if value > length {
+		return length
+	}
+	return value
+}
+
+// children returns the items of an array or the values of an object sorted by their keys
+func children(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = v[key]
+		}
+		return values
+	}
+	return nil
+}
+
+// descendants returns the value followed by everything below it
+func descendants(value interface{}) []interface{} {
+	values := []interface{}{value}
+	for _, child := range children(value) {
+		values = append(values, descendants(child)...)
+	}
+	return values
+}
+
+func (f *filter) match(root, value interface{}) bool {
+	values := f.left.eval(root, value)
+	if f.op == "" {
+		return len(values) > 0 && values[0] != nil && values[0] != false
+	}
+	if len(values) == 0 {
+		return f.op == "!="
+	}
+	left, right := values[0], f.right
+
+	if l, ok := number(left); ok {
+		if r, ok := number(right); ok {
+			return compare(f.op, l < r, l == r)
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return compare(f.op, l < r, l == r)
+		}
+	}
+	switch f.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+	return false
+}
+
+func compare(op string, less, equal bool) bool {
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	}
+	return !less
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
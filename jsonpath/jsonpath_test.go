@@ -0,0 +1,101 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const books = `[
+	{"Isbn":"123","Title":"Pod igoto","Author":"Ivan Vazov","AvailableUnits":12,"tags":["classic","novel"]},
+	{"Isbn":"456","Title":"Bai Ganyo","Author":"Aleko Konstantinov","AvailableUnits":0},
+	{"Isbn":"789","Title":"Tyutyun","Author":"Dimitar Dimov","AvailableUnits":3}
+]`
+
+func Test_Execute(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "all titles", template: "{.[*].Title}", expected: "Pod igoto Bai Ganyo Tyutyun"},
+		{name: "root", template: "{$[0].Isbn}", expected: "123"},
+		{name: "negative index", template: "{.[-1].Isbn}", expected: "789"},
+		{name: "slice", template: "{.[0:2].Isbn}", expected: "123 456"},
+		{name: "open slice", template: "{.[1:].Isbn}", expected: "456 789"},
+		{name: "quoted field", template: "{.[0]['Title']}", expected: "Pod igoto"},
+		{name: "number", template: "{.[0].AvailableUnits}", expected: "12"},
+		{name: "array value", template: "{.[0].tags}", expected: `["classic","novel"]`},
+		{name: "recursive", template: "{..tags[1]}", expected: "novel"},
+		{name: "missing field", template: "{.[*].Publisher}", expected: ""},
+		{name: "text around", template: "books: {.[*].Isbn}!", expected: "books: 123 456 789!"},
+		{name: "filter number", template: "{.[?(@.AvailableUnits > 0)].Isbn}", expected: "123 789"},
+		{name: "filter string", template: `{.[?(@.Author == "Ivan Vazov")].Title}`, expected: "Pod igoto"},
+		{name: "filter single quotes", template: `{.[?(@.Author != 'Ivan Vazov')].Isbn}`, expected: "456 789"},
+		{name: "filter exists", template: "{.[?(@.tags)].Isbn}", expected: "123"},
+		{name: "filter less", template: "{.[?(@.AvailableUnits < 3)].Isbn}", expected: "456"},
+		{name: "filter at most", template: "{.[?(@.AvailableUnits <= 3)].Isbn}", expected: "456 789"},
+		{name: "filter at least", template: "{.[?(@.Title >= 'Pod igoto')].Isbn}", expected: "123 789"},
+		{
+			name:     "range",
+			template: `{range .[*]}{.Isbn}{"\t"}{.AvailableUnits}{"\n"}{end}`,
+			expected: "123\t12\n456\t0\n789\t3\n",
+		},
+		{
+			name:     "nested range",
+			template: `{range .[?(@.tags)]}{.Isbn}:{range .tags[*]} {@}{end}{end}`,
+			expected: "123: classic novel",
+		},
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(books), &data); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if !assert.Nil(t, err) {
+				return
+			}
+			var buf bytes.Buffer
+			assert.Nil(t, tmpl.Execute(&buf, data))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func Test_ParseErrors(t *testing.T) {
+	for _, template := range []string{
+		"{.[0]",
+		"{range .[*]}{.Isbn}",
+		"{end}",
+		"{.[x]}",
+		"{.[?(@.a > x)]}",
+		`{"unterminated}`,
+		"{.a b}",
+	} {
+		_, err := Parse(template)
+		assert.NotNil(t, err, template)
+	}
+}
+
+func Test_ParseUnsupported(t *testing.T) {
+	tests := []struct {
+		template      string
+		expectedError string
+	}{
+		{"{..*}", `jsonpath: ..* is not supported in "..*", name the field after ..`},
+		{"{.[0,1].Isbn}", "jsonpath: unions like [0,1] are not supported"},
+		{"{.[0]['Isbn','Title']}", "jsonpath: unions like ['Isbn','Title'] are not supported"},
+		{"{.[-2:].Isbn}", "jsonpath: negative slice bounds are not supported in [-2:]"},
+		{"{.[?(@.AvailableUnits > 0 && @.tags)].Isbn}", `jsonpath: && is not supported in filter "@.AvailableUnits > 0 && @.tags"`},
+		{"{.[?(@.tags == null)].Isbn}", "jsonpath: null is not supported in filters, compare with a number or a quoted string"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.template)
+		assert.EqualError(t, err, tt.expectedError, tt.template)
+	}
+}
@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrMalformed is returned when the token is not a jwt
+var ErrMalformed = errors.New("malformed jwt token")
+
+// Claims are the claims the library REST API puts in its tokens
+type Claims struct {
+	UserID     string
+	UserRole   string
+	AuthUUID   string
+	Authorized bool
+	// ExpiresAt is zero when the token has no exp claim
+	ExpiresAt time.Time
+}
+
+type rawClaims struct {
+	UserID     interface{} `json:"user_id"`
+	UserRole   string      `json:"user_role"`
+	AuthUUID   string      `json:"auth_uuid"`
+	Authorized bool        `json:"authorized"`
+	Exp        json.Number `json:"exp"`
+}
+
+// Parse decodes the claims of the token.
+//
+// The signature is not verified, the claims are only used to give early feedback
+// and the library REST API remains the one which decides if the token is valid.
+func Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	var raw rawClaims
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	claims := &Claims{
+		UserRole:   raw.UserRole,
+		AuthUUID:   raw.AuthUUID,
+		Authorized: raw.Authorized,
+	}
+	if raw.UserID != nil {
+		claims.UserID = fmt.Sprint(raw.UserID)
+	}
+	if raw.Exp != "" {
+		exp, err := raw.Exp.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid exp claim", ErrMalformed)
+		}
+		claims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return claims, nil
+}
+
+// Expired reports whether the token is expired at the given time
+func (c *Claims) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// ExpiresWithin reports whether the token is still valid at the given time
+// but expires before the window passes
+func (c *Claims) ExpiresWithin(now time.Time, window time.Duration) bool {
+	return !c.ExpiresAt.IsZero() && !c.Expired(now) && c.ExpiresAt.Sub(now) <= window
+}
@@ -0,0 +1,231 @@
+// Package yaml writes the yaml output of the cli.
+//
+// The cli has no yaml dependency, so values are marshaled to json first
+// and FromJSON turns the json into block style yaml keeping the order of the keys.
+// Reading yaml needs a full parser, so the files read by the cli are json.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type kind int
+
+const (
+	scalar kind = iota
+	str
+	object
+	array
+)
+
+// node is a decoded json value which keeps the order of the object keys
+type node struct {
+	kind kind
+	// text is the json text of a scalar or the value of a string
+	text   string
+	keys   []string
+	values []*node
+}
+
+// FromJSON converts a json document to yaml
+func FromJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	n, err := decodeNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the json value")
+	}
+
+	e := &encoder{}
+	switch {
+	case n.kind == object && len(n.keys) > 0:
+		e.mapping(n, 0)
+	case n.kind == array && len(n.values) > 0:
+		e.sequence(n, 0)
+	default:
+		e.buf.WriteString(e.inline(n))
+		e.buf.WriteByte('\n')
+	}
+	return e.buf.Bytes(), nil
+}
+
+// Marshal encodes the value as json with encoding/json and converts it to yaml
+func Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(data)
+}
+
+func decodeNode(decoder *json.Decoder) (*node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			n := &node{kind: object}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+				n.values = append(n.values, value)
+			}
+			_, err := decoder.Token()
+			return n, err
+		}
+		n := &node{kind: array}
+		for decoder.More() {
+			value, err := decodeNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, value)
+		}
+		_, err := decoder.Token()
+		return n, err
+	case string:
+		return &node{kind: str, text: t}, nil
+	case json.Number:
+		return &node{kind: scalar, text: t.String()}, nil
+	case bool:
+		return &node{kind: scalar, text: strconv.FormatBool(t)}, nil
+	default:
+		return &node{kind: scalar, text: "null"}, nil
+	}
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) indent(n int) {
+	e.buf.WriteString(strings.Repeat(" ", n))
+}
+
+// mapping writes the keys of the object, each on its own line
+func (e *encoder) mapping(n *node, indent int) {
+	for i, key := range n.keys {
+		e.indent(indent)
+		e.entry(key, n.values[i], indent)
+	}
+}
+
+// entry writes "key: value" where the first line is already indented
+func (e *encoder) entry(key string, value *node, indent int) {
+	e.buf.WriteString(quote(key))
+	e.buf.WriteByte(':')
+	e.value(value, indent+2)
+}
+
+// sequence writes the items of the array, each starting with "- "
+func (e *encoder) sequence(n *node, indent int) {
+	for _, item := range n.values {
+		e.indent(indent)
+		e.buf.WriteByte('-')
+		switch {
+		case item.kind == object && len(item.keys) > 0:
+			// the first key goes on the line of the dash
+			e.buf.WriteByte(' ')
+			for i, key := range item.keys {
+				if i > 0 {
+					e.indent(indent + 2)
+				}
+				e.entry(key, item.values[i], indent+2)
+			}
+		default:
+			e.value(item, indent+2)
+		}
+	}
+}
+
+// value writes the value following "key:" or "-", nested blocks start on the next line
+func (e *encoder) value(n *node, indent int) {
+	switch {
+	case n.kind == object && len(n.keys) > 0:
+		e.buf.WriteByte('\n')
+		e.mapping(n, indent)
+	case n.kind == array && len(n.values) > 0:
+		e.buf.WriteByte('\n')
+		e.sequence(n, indent)
+	default:
+		e.buf.WriteByte(' ')
+		e.buf.WriteString(e.inline(n))
+		e.buf.WriteByte('\n')
+	}
+}
+
+// inline returns scalars and empty collections in flow style
+func (e *encoder) inline(n *node) string {
+	switch n.kind {
+	case object:
+		return "{}"
+	case array:
+		return "[]"
+	case str:
+		return quote(n.text)
+	}
+	return n.text
+}
+
+var (
+	numberLike = regexp.MustCompile(`^[-+]?(\.?[0-9]|0[xob])`)
+	reserved   = map[string]bool{
+		"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+		"y": true, "n": true, "null": true, "~": true,
+	}
+)
+
+// quote returns the string as a plain scalar when yaml reads it back as the same string,
+// otherwise as a double quoted scalar
+func quote(s string) string {
+	if needsQuotes(s) {
+		return jsonString(s)
+	}
+	return s
+}
+
+// jsonString returns the string as a json string without escaping html
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || reserved[strings.ToLower(s)] || numberLike.MatchString(s) {
+		return true
+	}
+	if strings.ContainsRune("-?:,[]{}#&*!|>'\"%@` \t", rune(s[0])) || strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
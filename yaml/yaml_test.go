@@ -0,0 +1,62 @@
+package yaml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FromJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		expected string
+	}{{
+		name:     "object keeps the key order",
+		json:     `{"Isbn":"123","Title":"Pod igoto","Author":"Ivan Vazov","AvailableUnits":12}`,
+		expected: "Isbn: \"123\"\nTitle: Pod igoto\nAuthor: Ivan Vazov\nAvailableUnits: 12\n",
+	}, {
+		name: "list of objects with nested lists",
+		json: `[{"Email":"misho@gmail.com","TakenBooks":[{"Isbn":"978-0-13"}],"tags":["a","b"]},{"Email":"ivan@gmail.com","TakenBooks":[]}]`,
+		expected: `- Email: misho@gmail.com
+  TakenBooks:
+    - Isbn: "978-0-13"
+  tags:
+    - a
+    - b
+- Email: ivan@gmail.com
+  TakenBooks: []
+`,
+	}, {
+		name:     "strings which need quotes",
+		json:     `{"a":"","b":"true","c":"x: y","d":"line\nbreak","e":"#tag","f":"- item","g":" padded","h":"1e3","i":"No"}`,
+		expected: "a: \"\"\nb: \"true\"\nc: \"x: y\"\nd: \"line\\nbreak\"\ne: \"#tag\"\nf: \"- item\"\ng: \" padded\"\nh: \"1e3\"\ni: \"No\"\n",
+	}, {
+		name:     "scalars",
+		json:     `{"a":null,"b":false,"c":1.5,"d":{},"e":"<b>&</b>"}`,
+		expected: "a: null\nb: false\nc: 1.5\nd: {}\ne: <b>&</b>\n",
+	}, {
+		name:     "nested lists",
+		json:     `[[1,2],[]]`,
+		expected: "-\n  - 1\n  - 2\n- []\n",
+	}, {
+		name:     "empty list",
+		json:     `[]`,
+		expected: "[]\n",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := FromJSON([]byte(tt.json))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func Test_FromJSONInvalid(t *testing.T) {
+	_, err := FromJSON([]byte(`{"a":`))
+	assert.NotNil(t, err)
+	_, err = FromJSON([]byte(`{} {}`))
+	assert.NotNil(t, err)
+}